@@ -15,8 +15,11 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/dzhordano/balancer-go/internal/admin"
 	"github.com/dzhordano/balancer-go/internal/balancer"
 	"github.com/dzhordano/balancer-go/internal/config"
+	"github.com/dzhordano/balancer-go/internal/drain"
+	"github.com/dzhordano/balancer-go/internal/events"
 	"github.com/dzhordano/balancer-go/internal/healthcheck"
 	"github.com/dzhordano/balancer-go/internal/httpserver"
 	"github.com/dzhordano/balancer-go/internal/routes"
@@ -126,22 +129,42 @@ func main() {
 		}()
 	}
 
-	// Заполнение массива доступных серверов для балансировщика.
-	servers := make([]server.Server, len(cfg.Servers))
+	// Регистрация серверов, доступных балансировщику.
+	registry := server.NewRegistry()
 	for i := range cfg.Servers {
-		servers[i] = *server.NewServer(
+		backend := server.NewBackend(
+			cfg.Servers[i].ID,
 			cfg.Servers[i].URL,
 			cfg.Servers[i].Weight,
+			cfg.Servers[i].VirtualNodes,
 		)
+		if err := registry.Add(backend); err != nil {
+			log.Fatalf("error registering server: %s", err)
+		}
 	}
 
+	// Публикация изменений состояния серверов.
+	bus := events.NewBus(logging)
+	bus.Watch(registry)
+	events.StartWebhooks(logging, bus, cfg.Events.Webhooks)
+
 	// Инициализация обработчика балансировщика.
-	balancerHandler := balancer.NewBalancerHandler(logging, servers, cfg.BalancingAlg)
+	balancerHandler, err := balancer.NewBalancerHandler(logging, registry, cfg)
+	if err != nil {
+		logging.Error("error creating balancer", slog.String("error", err.Error()))
+		log.Fatalf("error creating balancer: %s", err)
+	}
 
 	// Запуск проверки статуса серверов.
+	healthChecker, err := healthcheck.NewHealthChecker(logging, registry, cfg)
+	if err != nil {
+		logging.Error("error creating health checker", slog.String("error", err.Error()))
+		log.Fatalf("error creating health checker: %s", err)
+	}
+
 	go func() {
 		fmt.Println("starting health check")
-		healthcheck.NewHealthChecker(logging, cfg.HealthCheck.Interval, cfg.HealthCheck.Timeout, balancerHandler.Balancer()).HealthCheck()
+		healthChecker.HealthCheck()
 	}()
 
 	// Инициализация балансировщика.
@@ -183,6 +206,41 @@ func main() {
 		}
 	}()
 
+	// Вывод серверов из балансировки без потери запросов: через admin api
+	// или сигналом SIGUSR1 для всех серверов сразу.
+	drainer := drain.NewDrainer(logging, registry, cfg.Drain)
+
+	drainChan := make(chan os.Signal, 1)
+	signal.Notify(drainChan, syscall.SIGUSR1)
+	go func() {
+		for range drainChan {
+			logging.Info("draining all servers")
+			drainer.DrainAll()
+		}
+	}()
+
+	// Запуск admin api, если указан порт.
+	var adminSrv *httpserver.HTTPServer
+	if cfg.AdminServer.Port != "" {
+		adminSrv = httpserver.NewHTTPServer(
+			net.JoinHostPort(cfg.AdminServer.Host, cfg.AdminServer.Port),
+			admin.NewAdminHandler(logging, bus, drainer).Routes(),
+		)
+
+		mainWG.Add(1)
+		go func() {
+			defer mainWG.Done()
+
+			logging.Info("starting admin http server", slog.String("server url", net.JoinHostPort(cfg.AdminServer.Host, cfg.AdminServer.Port)))
+
+			if err := adminSrv.Run(); err != nil {
+				logging.Error("error runnning admin http server",
+					slog.String("server url", net.JoinHostPort(cfg.AdminServer.Host, cfg.AdminServer.Port)),
+					slog.String("error", err.Error()))
+			}
+		}()
+	}
+
 	go func() {
 		http.Handle("/metrics", promhttp.Handler())
 		logging.Info("starting prometheus server", slog.String("server url", ":9091"))
@@ -202,6 +260,15 @@ func main() {
 
 	newTlsSrv.Shutdown(context.Background())
 	srv.Shutdown(context.Background())
+	balancerHandler.Close()
+	bus.Close()
+	if adminSrv != nil {
+		adminSrv.Shutdown(context.Background())
+	}
+
+	if err := healthChecker.Stop(context.Background()); err != nil {
+		logging.Error("error stopping health checker", slog.String("error", err.Error()))
+	}
 
 	mainWG.Wait()
 
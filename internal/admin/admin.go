@@ -0,0 +1,130 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/dzhordano/balancer-go/internal/drain"
+	"github.com/dzhordano/balancer-go/internal/events"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// sseBuffer is the number of events a slow client may be behind.
+	sseBuffer = 64
+	// sseKeepAlive is how often a comment is sent to idle clients, so
+	// proxies don't close the stream.
+	sseKeepAlive = 15 * time.Second
+)
+
+type adminHandler struct {
+	log     *slog.Logger
+	bus     *events.Bus
+	drainer *drain.Drainer
+}
+
+func NewAdminHandler(log *slog.Logger, bus *events.Bus, drainer *drain.Drainer) *adminHandler {
+	return &adminHandler{
+		log:     log,
+		bus:     bus,
+		drainer: drainer,
+	}
+}
+
+func (h *adminHandler) Routes() http.Handler {
+	r := chi.NewRouter()
+
+	r.Get("/admin/events", h.events)
+	r.Post("/admin/backends/{id}/drain", h.drain)
+	r.Post("/admin/backends/{id}/enable", h.enable)
+
+	return r
+}
+
+// drain starts draining the backend and returns right away, its progress is
+// published as events.
+func (h *adminHandler) drain(w http.ResponseWriter, r *http.Request) {
+	if err := h.drainer.Drain(chi.URLParam(r, "id")); err != nil {
+		if errors.Is(err, drain.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		h.log.Error("ADMIN: failed to drain server", slog.String("error", err.Error()))
+		http.Error(w, "failed to drain server", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// enable returns a drained backend to the health checks.
+func (h *adminHandler) enable(w http.ResponseWriter, r *http.Request) {
+	if err := h.drainer.Enable(chi.URLParam(r, "id")); err != nil {
+		if errors.Is(err, drain.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		h.log.Error("ADMIN: failed to enable server", slog.String("error", err.Error()))
+		http.Error(w, "failed to enable server", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// events streams the events of the bus as server-sent events.
+func (h *adminHandler) events(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+
+	// The stream outlives the write timeout of the server.
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe := h.bus.Subscribe(sseBuffer)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+
+			data, err := json.Marshal(e)
+			if err != nil {
+				h.log.Error("ADMIN: failed to encode event", slog.String("error", err.Error()))
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package admin
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dzhordano/balancer-go/internal/events"
+)
+
+func TestEventsStream(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	bus := events.NewBus(log)
+
+	srv := httptest.NewServer(NewAdminHandler(log, bus, nil).Routes())
+	t.Cleanup(srv.Close)
+
+	resp, err := http.Get(srv.URL + "/admin/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("content type = %q, want text/event-stream", got)
+	}
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	next := func() (string, bool) {
+		t.Helper()
+		select {
+		case line, ok := <-lines:
+			return line, ok
+		case <-time.After(time.Second):
+			t.Fatal("no line received")
+			return "", false
+		}
+	}
+
+	// The headers are sent once the client is subscribed.
+	want := events.Event{Type: events.TypeExcluded, Server: "a", URL: "http://a", Reason: "outlier", Time: time.Now().UTC()}
+	bus.Publish(want)
+
+	if line, _ := next(); line != "event: "+events.TypeExcluded {
+		t.Errorf("line = %q, want the event type", line)
+	}
+
+	line, _ := next()
+	data, ok := strings.CutPrefix(line, "data: ")
+	if !ok {
+		t.Fatalf("line = %q, want the event data", line)
+	}
+
+	var got events.Event
+	if err := json.Unmarshal([]byte(data), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Time.Equal(want.Time) {
+		t.Errorf("time = %s, want %s", got.Time, want.Time)
+	}
+	got.Time = want.Time
+	if got != want {
+		t.Errorf("event = %+v, want %+v", got, want)
+	}
+
+	if line, _ := next(); line != "" {
+		t.Errorf("line = %q, want the blank line ending the event", line)
+	}
+
+	// Closing the bus ends the stream.
+	bus.Close()
+	if line, ok := next(); ok {
+		t.Errorf("got %q after the bus was closed, want the end of the stream", line)
+	}
+}
@@ -1,107 +1,321 @@
 package balancer
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"time"
 
+	"github.com/dzhordano/balancer-go/internal/breaker"
+	"github.com/dzhordano/balancer-go/internal/config"
+	"github.com/dzhordano/balancer-go/internal/outlier"
 	"github.com/dzhordano/balancer-go/internal/server"
+	"github.com/dzhordano/balancer-go/internal/upstream"
 	"github.com/dzhordano/balancer-go/pkg/metrics"
-	"github.com/go-chi/chi/v5"
 )
 
 const (
 	roundRobinAlg         = "round_robin"
 	weightedRoundRobinAlg = "weighted_round_robin"
 	leastConnAlg          = "least_connections"
+	weightedLeastConnAlg  = "weighted_least_connections"
+	leastResponseTimeAlg  = "least_response_time"
 	hashAlg               = "hash"
+	rendezvousHashAlg     = "rendezvous_hash"
+	maglevAlg             = "maglev"
+	boundedLoadHashAlg    = "bounded_load_hash"
+	p2cAlg                = "p2c"
+	weightedP2CAlg        = "weighted_p2c"
+	peakEWMAAlg           = "peak_ewma"
 	randomAlg             = "random"
 )
 
+// Balancer selects a backend for every request. SetServers is called with the
+// alive backends on every membership change of the registry, the slice must
+// not be modified.
 type Balancer interface {
-	SetServers(servers []server.Server)
-	SelectServer(args ...interface{}) *server.Server
-	DownServers() []server.Server
-	AliveServers() []server.Server
-	AddAliveServer(server server.Server)
-	AddDownServer(server server.Server)
-	RemoveDownServer(index int)
-	RemoveAliveServer(index int)
+	SetServers(servers []*server.Backend)
+	SelectServer(ctx *SelectContext) *server.Backend
 }
+
+// Observer is implemented by balancers that adapt to the outcome of proxied
+// requests.
+type Observer interface {
+	Observe(srv *server.Backend, rtt time.Duration, err error)
+}
+
 type balancerHandler struct {
 	log      *slog.Logger
 	balancer Balancer
+	hashKey  keyFunc
+	proxy    config.Proxy
+	upstream *upstream.Pool
+	retry    *retryPolicy
+	hedges   []*hedgeRoute
+	breakers *breaker.Group
+	outliers *outlier.Detector
 }
 
-func NewBalancerHandler(log *slog.Logger, servers []server.Server, alg string) *balancerHandler {
-	var balancer Balancer
-	switch alg {
-	case roundRobinAlg:
-		balancer = &RoundRobinBalancer{}
-	case weightedRoundRobinAlg:
-		balancer = &WeightedRoundRobinBalancer{}
-	case leastConnAlg:
-		balancer = &LeastConnectionsBalancer{}
-	case hashAlg:
-		balancer = &HashBalancer{}
-	case randomAlg:
-		balancer = &RandomBalancer{}
-	default:
-		log.Error("unknown balancing algorithm", slog.String("algorithm", alg))
-		return nil
+func init() {
+	Register(roundRobinAlg, func(opts Options) (Balancer, error) {
+		return &RoundRobinBalancer{slowStart: newSlowStart(opts.SlowStart)}, nil
+	})
+	Register(weightedRoundRobinAlg, func(opts Options) (Balancer, error) {
+		return &WeightedRoundRobinBalancer{slowStart: newSlowStart(opts.SlowStart)}, nil
+	})
+	Register(leastConnAlg, func(opts Options) (Balancer, error) {
+		return &LeastConnectionsBalancer{slowStart: newSlowStart(opts.SlowStart)}, nil
+	})
+	Register(weightedLeastConnAlg, func(opts Options) (Balancer, error) {
+		lc := NewWeightedLeastConnectionsBalancer()
+		lc.slowStart = newSlowStart(opts.SlowStart)
+		return lc, nil
+	})
+	Register(leastResponseTimeAlg, func(opts Options) (Balancer, error) {
+		return NewLeastResponseTimeBalancer(opts.LeastResponseTime.Decay), nil
+	})
+	Register(hashAlg, func(Options) (Balancer, error) {
+		return &HashBalancer{}, nil
+	})
+	Register(rendezvousHashAlg, func(Options) (Balancer, error) {
+		return &RendezvousHashBalancer{}, nil
+	})
+	Register(maglevAlg, func(opts Options) (Balancer, error) {
+		return NewMaglevBalancer(opts.Maglev.TableSize)
+	})
+	Register(boundedLoadHashAlg, func(opts Options) (Balancer, error) {
+		return NewBoundedLoadHashBalancer(opts.BoundedLoad.Epsilon), nil
+	})
+	Register(p2cAlg, func(opts Options) (Balancer, error) {
+		pb := NewP2CBalancer(false)
+		pb.slowStart = newSlowStart(opts.SlowStart)
+		return pb, nil
+	})
+	Register(weightedP2CAlg, func(opts Options) (Balancer, error) {
+		pb := NewP2CBalancer(true)
+		pb.slowStart = newSlowStart(opts.SlowStart)
+		return pb, nil
+	})
+	Register(peakEWMAAlg, func(opts Options) (Balancer, error) {
+		return NewPeakEWMABalancer(opts.PeakEWMA.Decay), nil
+	})
+	Register(randomAlg, func(opts Options) (Balancer, error) {
+		return &RandomBalancer{slowStart: newSlowStart(opts.SlowStart)}, nil
+	})
+}
+
+func NewBalancerHandler(log *slog.Logger, registry *server.Registry, cfg *config.Config) (*balancerHandler, error) {
+	keyFn, err := newHashKeyFunc(cfg.HashKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hash key config: %w", err)
+	}
+
+	retry, err := newRetryPolicy(cfg.Retry)
+	if err != nil {
+		return nil, fmt.Errorf("invalid retry config: %w", err)
 	}
 
-	balancer.SetServers(servers)
+	balancer, err := New(cfg.BalancingAlg, cfg.BalancingOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	registry.Subscribe(balancer.SetServers)
+
+	pool := upstream.NewPool(cfg.Upstream)
+	pool.Watch(registry)
 
 	return &balancerHandler{
 		log:      log,
 		balancer: balancer,
-	}
+		hashKey:  keyFn,
+		proxy:    cfg.Proxy,
+		upstream: pool,
+		retry:    retry,
+		hedges:   newHedgeRoutes(cfg.Hedging),
+		breakers: breaker.NewGroup(log, registry, cfg.Breaker),
+		outliers: outlier.NewDetector(log, registry, cfg.Outlier),
+	}, nil
 }
 
+// Routes forwards every method and path. It is not a chi router, chi answers
+// methods it does not know, like PURGE, with 405.
 func (h *balancerHandler) Routes() http.Handler {
-	r := chi.NewRouter()
-
-	r.Get("/resource1", metrics.InstrumentHandler("/resource1", h.forwardRequest))
-	r.Get("/resource2", metrics.InstrumentHandler("/resource2", h.forwardRequest))
+	return metrics.InstrumentHandler("/*", h.forwardRequest)
+}
 
-	return r
+// Close stops the background work of the handler and closes the idle
+// upstream connections. Call it after the servers using Routes are shut down.
+func (h *balancerHandler) Close() {
+	h.outliers.Stop()
+	h.upstream.CloseIdleConnections()
 }
+
 func (h *balancerHandler) Balancer() Balancer {
 	return h.balancer
 }
 
 func (b *balancerHandler) forwardRequest(w http.ResponseWriter, r *http.Request) {
-	key := r.RemoteAddr // Используем IP клиента как ключ
-	server := b.balancer.SelectServer(key)
+	b.retry.budget.active.Add(1)
+	defer b.retry.budget.active.Add(-1)
+
+	canRetry := b.retry.allows(r)
+	route := matchHedgeRoute(b.hedges, r)
+
+	var body []byte
+	replayable := canRetry || route != nil
+	if replayable {
+		var err error
+		if body, replayable, err = bufferBody(r, b.retry.maxBodySize); err != nil {
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Bodies bigger than the limit can be sent only once.
+	if !replayable {
+		canRetry, route = false, nil
+	}
+
+	sel := &SelectContext{
+		Request:  r,
+		ClientIP: clientIP(r),
+		HashKey:  b.hashKey(r),
+	}
+
+	server := b.selectServer(sel)
 	if server == nil {
 		http.Error(w, "no available servers", http.StatusServiceUnavailable)
 		return
 	}
 
-	server.IncrementConnections()
-	defer server.DecrementConnections()
+	for {
+		var (
+			resp *http.Response
+			err  error
+		)
 
-	targetURL := fmt.Sprintf("http://%s%s", server.URL, r.URL.Path)
-	b.log.Debug("forwarding request to", slog.String("url", targetURL))
-	req, err := http.NewRequest(r.Method, targetURL, r.Body)
-	if err != nil {
-		b.log.Error("failed to create request", slog.String("url", targetURL), slog.String("error", err.Error()))
+		switch {
+		case route != nil:
+			resp, server, err = b.hedge(r, body, server, sel, route)
+		case replayable:
+			resp, err = b.send(r, bytes.NewReader(body), server)
+		default:
+			resp, err = b.send(r, r.Body, server)
+		}
+
+		if sel.Attempt > 0 {
+			b.retry.budget.release()
+		}
+
+		if canRetry && sel.Attempt < b.retry.attempts && r.Context().Err() == nil && b.retry.shouldRetry(resp, err) {
+			sel.Tried = append(sel.Tried, server)
+			sel.Attempt++
+
+			// Retries always go to a backend that was not tried yet.
+			if b.retry.budget.tryAcquire() {
+				if next := b.selectServer(sel); next != nil {
+					b.log.Info("retrying request", slog.String("server", server.URL), slog.String("next", next.URL), slog.Int("attempt", sel.Attempt))
+
+					if err == nil {
+						resp.Body.Close()
+						server.DecrementConnections()
+					}
+
+					server = next
+					continue
+				}
+				b.retry.budget.release()
+			}
+		}
+
+		if err != nil {
+			http.Error(w, "failed to forward request", http.StatusBadGateway)
+			return
+		}
+
+		defer server.DecrementConnections()
+		defer resp.Body.Close()
+
+		if err := writeResponse(w, resp); err != nil {
+			b.log.Debug("failed to copy response", slog.String("server", server.URL), slog.String("error", err.Error()))
+		}
 
-		http.Error(w, "failed to create request", http.StatusInternalServerError)
 		return
 	}
+}
 
-	resp, err := http.DefaultClient.Do(req)
+// selectServer selects a backend whose circuit breaker lets the request
+// through. Backends rejected by their breaker count as tried.
+func (b *balancerHandler) selectServer(sel *SelectContext) *server.Backend {
+	for {
+		srv := b.balancer.SelectServer(sel)
+		if srv == nil || sel.WasTried(srv) {
+			return nil
+		}
+
+		if b.breakers.Get(srv).Allow() {
+			return srv
+		}
+		sel.Tried = append(sel.Tried, srv)
+	}
+}
+
+// send forwards r to server, which must come from selectServer. The server's
+// connection counter stays incremented until the caller is done with a
+// returned response.
+func (b *balancerHandler) send(r *http.Request, body io.Reader, server *server.Backend) (*http.Response, error) {
+	server.IncrementConnections()
+	brk := b.breakers.Get(server)
+
+	req, err := newUpstreamRequest(r, body, server, b.upstream.Scheme(), b.proxy)
 	if err != nil {
-		b.log.Error("failed to forward request", slog.String("url", targetURL), slog.String("error", err.Error()))
+		server.DecrementConnections()
+		brk.Cancel()
+		b.log.Error("failed to create request", slog.String("server", server.URL), slog.String("error", err.Error()))
+		return nil, err
+	}
+	b.log.Debug("forwarding request to", slog.String("url", req.URL.String()))
 
-		http.Error(w, "failed to forward request", http.StatusBadGateway)
-		return
+	start := time.Now()
+	resp, err := b.upstream.Get(server).RoundTrip(req)
+
+	// Requests canceled by the client or by a winning hedge say nothing
+	// about the backend.
+	if observer, ok := b.balancer.(Observer); ok && req.Context().Err() == nil {
+		observer.Observe(server, time.Since(start), err)
+	}
+
+	if err != nil && errors.Is(req.Context().Err(), context.Canceled) {
+		// The client went away or another hedge won, the backend is not to blame.
+		brk.Cancel()
+	} else {
+		status := http.StatusBadGateway
+		if err == nil {
+			status = resp.StatusCode
+		}
+
+		brk.Record(status < http.StatusInternalServerError)
+		b.outliers.Record(server, status)
 	}
-	defer resp.Body.Close()
 
-	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+	if err != nil {
+		server.DecrementConnections()
+		b.log.Error("failed to forward request", slog.String("url", req.URL.String()), slog.String("error", err.Error()))
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// serverWeight returns the weight of srv, treating unset weights as 1.
+func serverWeight(srv *server.Backend) int {
+	if srv.Weight <= 0 {
+		return 1
+	}
+	return srv.Weight
 }
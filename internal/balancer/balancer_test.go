@@ -0,0 +1,101 @@
+package balancer
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+	"github.com/dzhordano/balancer-go/internal/server"
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+// observingBalancer records the outcomes observed by the handler.
+type observingBalancer struct {
+	RoundRobinBalancer
+
+	mu       sync.Mutex
+	observed []error
+}
+
+func (o *observingBalancer) Observe(_ *server.Backend, _ time.Duration, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.observed = append(o.observed, err)
+}
+
+func (o *observingBalancer) observations() []error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]error(nil), o.observed...)
+}
+
+func newObservedHandler(t *testing.T, handler http.HandlerFunc) (*balancerHandler, *observingBalancer) {
+	t.Helper()
+
+	backend := httptest.NewServer(handler)
+	t.Cleanup(backend.Close)
+
+	var cfg config.Config
+	if err := cleanenv.ReadEnv(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.BalancingAlg = roundRobinAlg
+
+	registry := server.NewRegistry()
+	if err := registry.Add(server.NewBackend("", strings.TrimPrefix(backend.URL, "http://"), 1, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := NewBalancerHandler(slog.New(slog.NewTextHandler(io.Discard, nil)), registry, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(h.Close)
+
+	observer := &observingBalancer{}
+	registry.Subscribe(observer.SetServers)
+	h.balancer = observer
+
+	return h, observer
+}
+
+func TestSendObservesResponses(t *testing.T) {
+	h, observer := newObservedHandler(t, func(w http.ResponseWriter, r *http.Request) {})
+
+	rec := httptest.NewRecorder()
+	h.forwardRequest(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if got := observer.observations(); len(got) != 1 || got[0] != nil {
+		t.Errorf("observed %v, want one success", got)
+	}
+}
+
+func TestSendSkipsObserveOfCanceledRequests(t *testing.T) {
+	received := make(chan struct{})
+	h, observer := newObservedHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		<-r.Context().Done()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-received
+		cancel()
+	}()
+
+	h.forwardRequest(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+
+	if got := observer.observations(); len(got) != 0 {
+		t.Errorf("observed %v for a canceled request, want nothing", got)
+	}
+}
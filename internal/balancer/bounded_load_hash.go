@@ -0,0 +1,63 @@
+package balancer
+
+import (
+	"math"
+	"sync/atomic"
+
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+const defaultBoundedLoadEpsilon = 0.25
+
+// BoundedLoadHashBalancer implements consistent hashing with bounded loads.
+// A key goes to its owner on the hash ring unless the owner already has more
+// than (1+epsilon) times its share of the in-flight requests, in which case
+// the next server on the ring is tried.
+type BoundedLoadHashBalancer struct {
+	alive   atomic.Pointer[ringSnapshot]
+	epsilon float64
+}
+
+func NewBoundedLoadHashBalancer(epsilon float64) *BoundedLoadHashBalancer {
+	if epsilon <= 0 {
+		epsilon = defaultBoundedLoadEpsilon
+	}
+
+	return &BoundedLoadHashBalancer{epsilon: epsilon}
+}
+
+func (bl *BoundedLoadHashBalancer) SetServers(servers []*server.Backend) {
+	bl.alive.Store(&ringSnapshot{servers: servers, ring: newHashRing(servers)})
+}
+
+func (bl *BoundedLoadHashBalancer) SelectServer(ctx *SelectContext) *server.Backend {
+	alive := bl.alive.Load()
+	if alive == nil || len(alive.servers) == 0 {
+		return nil
+	}
+
+	// The request being balanced counts towards the total load.
+	total := int64(1)
+	totalWeight := 0
+	for _, srv := range alive.servers {
+		total += srv.CurrentConnections()
+		totalWeight += serverWeight(srv)
+	}
+
+	index := alive.ring.walk(ctx.HashKey, len(alive.servers), func(index int) bool {
+		srv := alive.servers[index]
+		if ctx.WasTried(srv) {
+			return false
+		}
+
+		share := float64(total) * float64(serverWeight(srv)) / float64(totalWeight)
+		limit := int64(math.Ceil((1 + bl.epsilon) * share))
+
+		return srv.CurrentConnections()+1 <= limit
+	})
+	if index < 0 {
+		return nil
+	}
+
+	return alive.servers[index]
+}
@@ -0,0 +1,115 @@
+package balancer
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+// ringOrder returns the servers in the order the ring walks them for key.
+func ringOrder(bl *BoundedLoadHashBalancer, key string) []*server.Backend {
+	alive := bl.alive.Load()
+
+	var order []*server.Backend
+	alive.ring.walk(key, len(alive.servers), func(index int) bool {
+		order = append(order, alive.servers[index])
+		return false
+	})
+
+	return order
+}
+
+func TestBoundedLoadHashCapsLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []int
+		epsilon float64
+		keys    int // distinct keys, 1 sends every request to the same owner
+	}{
+		{name: "hot key", weights: []int{1, 1, 1, 1, 1}, epsilon: 0.25, keys: 1},
+		{name: "few keys", weights: []int{1, 1, 1, 1, 1}, epsilon: 0.25, keys: 3},
+		{name: "many keys", weights: []int{1, 1, 1, 1, 1}, epsilon: 0.1, keys: 1000},
+		{name: "weighted hot key", weights: []int{1, 2, 3}, epsilon: 0.25, keys: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			servers := newWeightedServers(tt.weights...)
+			bl := NewBoundedLoadHashBalancer(tt.epsilon)
+			bl.SetServers(servers)
+
+			totalWeight := 0
+			for _, w := range tt.weights {
+				totalWeight += w
+			}
+
+			// Every pick holds its connection, the load only grows.
+			for i := 1; i <= 500; i++ {
+				srv := bl.SelectServer(&SelectContext{HashKey: fmt.Sprintf("key-%d", i%tt.keys)})
+				if srv == nil {
+					t.Fatalf("request %d was not balanced", i)
+				}
+				srv.IncrementConnections()
+
+				for _, s := range servers {
+					share := float64(i) * float64(s.Weight) / float64(totalWeight)
+					if limit := int64(math.Ceil((1 + tt.epsilon) * share)); s.CurrentConnections() > limit {
+						t.Fatalf("after %d requests %s has %d, above ⌈(1+ε)×share⌉ = %d", i, s.ID, s.CurrentConnections(), limit)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestBoundedLoadHashOverflowWalksRing(t *testing.T) {
+	const key = "tenant-1"
+
+	tests := []struct {
+		name    string
+		preload []int64 // connections of the servers in ring order for key
+		want    int     // position of the selected server in ring order
+	}{
+		{name: "owner under the cap", preload: []int64{1, 1, 1, 1}, want: 0},
+		{name: "owner full", preload: []int64{10, 0, 0, 0}, want: 1},
+		{name: "owner and next full", preload: []int64{10, 10, 0, 0}, want: 2},
+		{name: "all but the last full", preload: []int64{10, 10, 10, 0}, want: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bl := NewBoundedLoadHashBalancer(0.25)
+			bl.SetServers(newRingServers(4))
+
+			order := ringOrder(bl, key)
+			for i, srv := range order {
+				for range tt.preload[i] {
+					srv.IncrementConnections()
+				}
+			}
+
+			if srv := bl.SelectServer(&SelectContext{HashKey: key}); srv != order[tt.want] {
+				t.Errorf("selected %s, want %s, number %d on the ring", srv.ID, order[tt.want].ID, tt.want+1)
+			}
+		})
+	}
+}
+
+func TestBoundedLoadHashOverflowSkipsTried(t *testing.T) {
+	const key = "tenant-1"
+
+	bl := NewBoundedLoadHashBalancer(0.25)
+	bl.SetServers(newRingServers(4))
+	order := ringOrder(bl, key)
+
+	for range 10 {
+		order[0].IncrementConnections()
+	}
+
+	ctx := &SelectContext{HashKey: key, Tried: []*server.Backend{order[1]}}
+	if srv := bl.SelectServer(ctx); srv != order[2] {
+		t.Errorf("selected %s, want %s, the next untried server on the ring", srv.ID, order[2].ID)
+	}
+}
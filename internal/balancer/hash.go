@@ -1,79 +1,38 @@
 package balancer
 
 import (
-	"hash/crc32"
-	"sync"
+	"sync/atomic"
 
 	"github.com/dzhordano/balancer-go/internal/server"
 )
 
 type HashBalancer struct {
-	downServers  []server.Server
-	aliveServers []server.Server
-	mu           sync.Mutex
+	alive atomic.Pointer[ringSnapshot]
 }
 
-func (hb *HashBalancer) SetServers(servers []server.Server) {
-	hb.mu.Lock()
-	defer hb.mu.Unlock()
-	hb.aliveServers = servers
+type ringSnapshot struct {
+	servers []*server.Backend
+	ring    *hashRing
 }
 
-func (hb *HashBalancer) SelectServer(args ...interface{}) *server.Server {
-	hb.mu.Lock()
-	defer hb.mu.Unlock()
+func (hb *HashBalancer) SetServers(servers []*server.Backend) {
+	hb.alive.Store(&ringSnapshot{servers: servers, ring: newHashRing(servers)})
+}
 
-	if len(hb.aliveServers) == 0 {
+// SelectServer returns the owner of the hash key. Retries walk the ring
+// clockwise to the next backend that was not tried.
+func (hb *HashBalancer) SelectServer(ctx *SelectContext) *server.Backend {
+	alive := hb.alive.Load()
+	if alive == nil {
 		return nil
 	}
 
-	if len(args) < 1 {
-		return nil // FIXME Требуется ключ
-	}
-
-	key, ok := args[0].(string)
-	if !ok {
+	index := alive.ring.walk(ctx.HashKey, len(alive.servers), func(index int) bool {
+		return !ctx.WasTried(alive.servers[index])
+	})
+	if index < 0 {
 		return nil
 	}
 
-	hash := crc32.ChecksumIEEE([]byte(key))
-	index := int(hash) % len(hb.aliveServers)
-
-	return &hb.aliveServers[index]
-}
-
-func (hb *HashBalancer) DownServers() []server.Server {
-	hb.mu.Lock()
-	defer hb.mu.Unlock()
-	return hb.downServers
-}
-
-func (hb *HashBalancer) RemoveAliveServer(index int) {
-	hb.mu.Lock()
-	defer hb.mu.Unlock()
-	hb.aliveServers = append(hb.aliveServers[:index], hb.aliveServers[index+1:]...)
-}
-
-func (hb *HashBalancer) RemoveDownServer(index int) {
-	hb.mu.Lock()
-	defer hb.mu.Unlock()
-	hb.downServers = append(hb.downServers[:index], hb.downServers[index+1:]...)
-}
-
-func (hb *HashBalancer) AddAliveServer(server server.Server) {
-	hb.mu.Lock()
-	defer hb.mu.Unlock()
-	hb.aliveServers = append(hb.aliveServers, server)
-}
-
-func (hb *HashBalancer) AddDownServer(server server.Server) {
-	hb.mu.Lock()
-	defer hb.mu.Unlock()
-	hb.downServers = append(hb.downServers, server)
-}
-
-func (hb *HashBalancer) AliveServers() []server.Server {
-	hb.mu.Lock()
-	defer hb.mu.Unlock()
-	return hb.aliveServers
+	return alive.servers[index]
 }
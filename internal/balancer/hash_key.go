@@ -0,0 +1,154 @@
+package balancer
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+)
+
+const templateKeySource = "template"
+
+// keyFunc extracts the hashing key from a request. An empty string means the
+// source is missing in the request.
+type keyFunc func(r *http.Request) string
+
+// newHashKeyFunc builds the function used to compute hash keys from the
+// hash_key config section. Sources are "ip", "path", "header:<name>",
+// "cookie:<name>", "query:<name>" or "template".
+func newHashKeyFunc(cfg config.HashKey) (keyFunc, error) {
+	var (
+		primary keyFunc
+		err     error
+	)
+
+	if cfg.Source == templateKeySource {
+		primary, err = parseKeyTemplate(cfg.Template)
+	} else {
+		primary, err = parseKeySource(cfg.Source)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Fallback == "" {
+		return primary, nil
+	}
+
+	fallback, err := parseKeySource(cfg.Fallback)
+	if err != nil {
+		return nil, fmt.Errorf("fallback: %w", err)
+	}
+
+	return func(r *http.Request) string {
+		if key := primary(r); key != "" {
+			return key
+		}
+		return fallback(r)
+	}, nil
+}
+
+func parseKeySource(source string) (keyFunc, error) {
+	kind, name, _ := strings.Cut(source, ":")
+
+	switch kind {
+	case "", "ip":
+		return clientIP, nil
+	case "path":
+		return func(r *http.Request) string { return r.URL.Path }, nil
+	}
+
+	if name == "" {
+		return nil, fmt.Errorf("hash key source %q requires a name, e.g. %s:<name>", source, kind)
+	}
+
+	switch kind {
+	case "header":
+		return func(r *http.Request) string { return r.Header.Get(name) }, nil
+	case "cookie":
+		return func(r *http.Request) string {
+			c, err := r.Cookie(name)
+			if err != nil {
+				return ""
+			}
+			return c.Value
+		}, nil
+	case "query":
+		return func(r *http.Request) string { return r.URL.Query().Get(name) }, nil
+	default:
+		return nil, fmt.Errorf("unknown hash key source %q", source)
+	}
+}
+
+// parseKeyTemplate parses templates like "{header:X-Tenant}/{cookie:session}".
+// The key is missing only if every placeholder is missing.
+func parseKeyTemplate(template string) (keyFunc, error) {
+	if template == "" {
+		return nil, fmt.Errorf("hash key template is empty")
+	}
+
+	var (
+		literals []string
+		sources  []keyFunc
+	)
+
+	rest := template
+	for {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			break
+		}
+
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("hash key template %q: unclosed placeholder", template)
+		}
+
+		source, err := parseKeySource(rest[start+1 : start+end])
+		if err != nil {
+			return nil, fmt.Errorf("hash key template %q: %w", template, err)
+		}
+
+		literals = append(literals, rest[:start])
+		sources = append(sources, source)
+		rest = rest[start+end+1:]
+	}
+
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("hash key template %q has no placeholders", template)
+	}
+
+	return func(r *http.Request) string {
+		var (
+			sb    strings.Builder
+			found bool
+		)
+
+		for i := range sources {
+			sb.WriteString(literals[i])
+
+			value := sources[i](r)
+			if value != "" {
+				found = true
+			}
+			sb.WriteString(value)
+		}
+		sb.WriteString(rest)
+
+		if !found {
+			return ""
+		}
+		return sb.String()
+	}, nil
+}
+
+// clientIP returns the address of the client without the ephemeral port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,119 @@
+package balancer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+)
+
+func TestHashKey(t *testing.T) {
+	// newRequest returns a request from 10.1.2.3 to /users/42?tenant=acme,
+	// cookies are set through the Cookie header.
+	newRequest := func(headers map[string]string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/users/42?tenant=acme", nil)
+		r.RemoteAddr = "10.1.2.3:52000"
+		for name, value := range headers {
+			r.Header.Set(name, value)
+		}
+		return r
+	}
+
+	tests := []struct {
+		name    string
+		cfg     config.HashKey
+		headers map[string]string
+		want    string
+		wantErr string
+	}{
+		{name: "ip", cfg: config.HashKey{Source: "ip"}, want: "10.1.2.3"},
+		{name: "empty source is ip", cfg: config.HashKey{}, want: "10.1.2.3"},
+		{name: "path", cfg: config.HashKey{Source: "path"}, want: "/users/42"},
+		{name: "header", cfg: config.HashKey{Source: "header:X-Tenant"}, headers: map[string]string{"X-Tenant": "acme"}, want: "acme"},
+		{name: "cookie", cfg: config.HashKey{Source: "cookie:session"}, headers: map[string]string{"Cookie": "session=s1; theme=dark"}, want: "s1"},
+		{name: "query", cfg: config.HashKey{Source: "query:tenant"}, want: "acme"},
+		{name: "missing header", cfg: config.HashKey{Source: "header:X-Tenant"}, want: ""},
+		{name: "missing cookie", cfg: config.HashKey{Source: "cookie:session"}, want: ""},
+		{name: "source without name", cfg: config.HashKey{Source: "header"}, wantErr: "requires a name"},
+		{name: "unknown source", cfg: config.HashKey{Source: "body:id"}, wantErr: "unknown hash key source"},
+
+		{
+			name:    "template",
+			cfg:     config.HashKey{Source: "template", Template: "{header:X-Tenant}/{cookie:session}"},
+			headers: map[string]string{"X-Tenant": "acme", "Cookie": "session=s1"},
+			want:    "acme/s1",
+		},
+		{
+			name:    "template with literals around placeholders",
+			cfg:     config.HashKey{Source: "template", Template: "t-{header:X-Tenant}:{path}!"},
+			headers: map[string]string{"X-Tenant": "acme"},
+			want:    "t-acme:/users/42!",
+		},
+		{
+			name:    "template with some placeholders missing",
+			cfg:     config.HashKey{Source: "template", Template: "{header:X-Tenant}/{cookie:session}"},
+			headers: map[string]string{"Cookie": "session=s1"},
+			want:    "/s1",
+		},
+		{
+			name: "template with every placeholder missing",
+			cfg:  config.HashKey{Source: "template", Template: "{header:X-Tenant}/{cookie:session}"},
+			want: "",
+		},
+		{name: "unclosed placeholder", cfg: config.HashKey{Source: "template", Template: "{header:X-Tenant}/{cookie:session"}, wantErr: "unclosed placeholder"},
+		{name: "no placeholders", cfg: config.HashKey{Source: "template", Template: "static"}, wantErr: "has no placeholders"},
+		{name: "empty template", cfg: config.HashKey{Source: "template"}, wantErr: "template is empty"},
+		{name: "bad placeholder", cfg: config.HashKey{Source: "template", Template: "{cookie}"}, wantErr: "requires a name"},
+
+		{
+			name:    "fallback unused",
+			cfg:     config.HashKey{Source: "header:X-Tenant", Fallback: "ip"},
+			headers: map[string]string{"X-Tenant": "acme"},
+			want:    "acme",
+		},
+		{name: "fallback to ip", cfg: config.HashKey{Source: "header:X-Tenant", Fallback: "ip"}, want: "10.1.2.3"},
+		{name: "fallback to query", cfg: config.HashKey{Source: "cookie:session", Fallback: "query:tenant"}, want: "acme"},
+		{
+			name: "template falls back when every placeholder is missing",
+			cfg:  config.HashKey{Source: "template", Template: "{header:X-Tenant}/{cookie:session}", Fallback: "path"},
+			want: "/users/42",
+		},
+		{name: "bad fallback", cfg: config.HashKey{Source: "ip", Fallback: "query"}, wantErr: "fallback"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyFn, err := newHashKeyFunc(tt.cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := keyFn(newRequest(tt.headers)); got != tt.want {
+				t.Errorf("key = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIPWithoutPort(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	r.RemoteAddr = "[2001:db8::1]:52000"
+	if got := clientIP(r); got != "2001:db8::1" {
+		t.Errorf("clientIP = %q, want 2001:db8::1", got)
+	}
+
+	// Addresses without a port are used as is.
+	r.RemoteAddr = "10.1.2.3"
+	if got := clientIP(r); got != "10.1.2.3" {
+		t.Errorf("clientIP = %q, want 10.1.2.3", got)
+	}
+}
@@ -0,0 +1,103 @@
+package balancer
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"sort"
+	"strconv"
+
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+const defaultVirtualNodes = 160
+
+// hashRing is a ketama-style consistent hash ring. Every server is placed on
+// the ring VirtualNodes*Weight times, so removing one server only remaps the
+// keys owned by its points.
+type hashRing struct {
+	points []ringPoint
+}
+
+type ringPoint struct {
+	hash  uint32
+	index int // index of the server in the slice the ring was built from
+}
+
+func newHashRing(servers []*server.Backend) *hashRing {
+	ring := &hashRing{}
+
+	for i := range servers {
+		n := virtualNodes(servers[i])
+
+		// Each md5 digest gives four points on the ring.
+		for j := 0; j*4 < n; j++ {
+			digest := md5.Sum([]byte(servers[i].ID + "-" + strconv.Itoa(j)))
+			for k := 0; k < 4 && j*4+k < n; k++ {
+				ring.points = append(ring.points, ringPoint{
+					hash:  binary.LittleEndian.Uint32(digest[k*4:]),
+					index: i,
+				})
+			}
+		}
+	}
+
+	sort.Slice(ring.points, func(a, b int) bool {
+		if ring.points[a].hash == ring.points[b].hash {
+			return servers[ring.points[a].index].ID < servers[ring.points[b].index].ID
+		}
+		return ring.points[a].hash < ring.points[b].hash
+	})
+
+	return ring
+}
+
+// walk calls fn with the index of every distinct server clockwise from the
+// point owning key until fn returns true. It returns the accepted index or -1.
+func (r *hashRing) walk(key string, servers int, fn func(index int) bool) int {
+	if len(r.points) == 0 {
+		return -1
+	}
+
+	seen := make([]bool, servers)
+	start := r.search(ketamaHash(key))
+	for i, left := 0, servers; i < len(r.points) && left > 0; i++ {
+		index := r.points[(start+i)%len(r.points)].index
+		if seen[index] {
+			continue
+		}
+
+		if fn(index) {
+			return index
+		}
+		seen[index] = true
+		left--
+	}
+
+	return -1
+}
+
+// search returns the position of the first point clockwise from hash.
+func (r *hashRing) search(hash uint32) int {
+	i := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i].hash >= hash
+	})
+	if i == len(r.points) {
+		i = 0
+	}
+
+	return i
+}
+
+func ketamaHash(key string) uint32 {
+	digest := md5.Sum([]byte(key))
+	return binary.LittleEndian.Uint32(digest[:4])
+}
+
+func virtualNodes(srv *server.Backend) int {
+	vnodes := srv.VirtualNodes
+	if vnodes <= 0 {
+		vnodes = defaultVirtualNodes
+	}
+
+	return vnodes * serverWeight(srv)
+}
@@ -0,0 +1,130 @@
+package balancer
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+const ringKeys = 100000
+
+func newRingServers(n int) []*server.Backend {
+	servers := make([]*server.Backend, n)
+	for i := range servers {
+		url := fmt.Sprintf("http://10.0.0.%d:8080", i+1)
+		servers[i] = server.NewBackend("", url, 1, 0)
+	}
+	return servers
+}
+
+func owners(hb *HashBalancer) []*server.Backend {
+	owners := make([]*server.Backend, ringKeys)
+	for i := range owners {
+		owners[i] = hb.SelectServer(&SelectContext{HashKey: fmt.Sprintf("key-%d", i)})
+	}
+	return owners
+}
+
+func TestHashRingRemoveMovesOnlyRemovedKeys(t *testing.T) {
+	for _, n := range []int{3, 5, 10, 20} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			servers := newRingServers(n)
+			removed := servers[n/2]
+
+			hb := &HashBalancer{}
+			hb.SetServers(servers)
+			before := owners(hb)
+
+			rest := append(append([]*server.Backend(nil), servers[:n/2]...), servers[n/2+1:]...)
+			hb.SetServers(rest)
+			after := owners(hb)
+
+			moved := 0
+			for i := range before {
+				if before[i] == after[i] {
+					continue
+				}
+				if before[i] != removed {
+					t.Fatalf("key-%d moved from %s, which was not removed", i, before[i].ID)
+				}
+				moved++
+			}
+
+			// Only the removed server's share moves, about 1/n of the keys.
+			fraction := float64(moved) / ringKeys
+			if want := 1 / float64(n); math.Abs(fraction-want) > want*0.3 {
+				t.Errorf("%.1f%% of keys moved, want about %.1f%%", fraction*100, want*100)
+			}
+		})
+	}
+}
+
+func TestHashRingAddMovesKeysToNewServer(t *testing.T) {
+	servers := newRingServers(11)
+
+	hb := &HashBalancer{}
+	hb.SetServers(servers[:10])
+	before := owners(hb)
+
+	hb.SetServers(servers)
+	after := owners(hb)
+
+	moved := 0
+	for i := range before {
+		if before[i] == after[i] {
+			continue
+		}
+		if after[i] != servers[10] {
+			t.Fatalf("key-%d moved to %s, which was not added", i, after[i].ID)
+		}
+		moved++
+	}
+
+	if fraction := float64(moved) / ringKeys; fraction < 0.06 || fraction > 0.12 {
+		t.Errorf("%.1f%% of keys moved, want about 9.1%%", fraction*100)
+	}
+}
+
+func TestHashRingWeights(t *testing.T) {
+	servers := newRingServers(3)
+	servers[0].Weight = 2
+
+	hb := &HashBalancer{}
+	hb.SetServers(servers)
+
+	counts := make(map[*server.Backend]int)
+	for _, srv := range owners(hb) {
+		counts[srv]++
+	}
+
+	// Weights 2,1,1 own about half, a quarter and a quarter of the keys.
+	for srv, want := range map[*server.Backend]float64{servers[0]: 0.5, servers[1]: 0.25, servers[2]: 0.25} {
+		if got := float64(counts[srv]) / ringKeys; math.Abs(got-want) > 0.05 {
+			t.Errorf("%s owns %.1f%% of keys, want about %.0f%%", srv.ID, got*100, want*100)
+		}
+	}
+}
+
+func TestHashRingRetryWalksToUntriedServers(t *testing.T) {
+	servers := newRingServers(4)
+
+	hb := &HashBalancer{}
+	hb.SetServers(servers)
+
+	ctx := &SelectContext{HashKey: "session-42"}
+	seen := make(map[*server.Backend]bool)
+	for range servers {
+		srv := hb.SelectServer(ctx)
+		if srv == nil || seen[srv] {
+			t.Fatalf("attempt %d selected %v", len(ctx.Tried), srv)
+		}
+		seen[srv] = true
+		ctx.Tried = append(ctx.Tried, srv)
+	}
+
+	if srv := hb.SelectServer(ctx); srv != nil {
+		t.Errorf("selected %s with every server tried", srv.ID)
+	}
+}
@@ -0,0 +1,238 @@
+package balancer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+	"github.com/dzhordano/balancer-go/internal/server"
+	"github.com/dzhordano/balancer-go/pkg/metrics"
+)
+
+const (
+	defaultHedgeDelay = 50 * time.Millisecond
+
+	// hedgeWindow is the number of latest latencies the p95 is computed
+	// from, it is recomputed every hedgeRecompute observations.
+	hedgeWindow     = 1024
+	hedgeRecompute  = 64
+	hedgeMinSamples = 32
+)
+
+// hedgeRoute duplicates slow requests on a path prefix to other backends.
+type hedgeRoute struct {
+	path      string
+	delay     time.Duration
+	useP95    bool
+	maxHedges int
+
+	mu      sync.Mutex
+	samples []time.Duration // ring buffer of the latest latencies
+	pos     int
+	seen    int
+	p95     atomic.Int64
+}
+
+func newHedgeRoutes(cfg config.Hedging) []*hedgeRoute {
+	routes := make([]*hedgeRoute, 0, len(cfg.Routes))
+	for _, rc := range cfg.Routes {
+		route := &hedgeRoute{
+			path:      rc.Path,
+			delay:     rc.Delay,
+			useP95:    rc.UseP95,
+			maxHedges: rc.MaxHedges,
+		}
+
+		if route.delay <= 0 {
+			route.delay = defaultHedgeDelay
+		}
+		if route.maxHedges <= 0 {
+			route.maxHedges = 1
+		}
+
+		routes = append(routes, route)
+	}
+
+	return routes
+}
+
+// matchHedgeRoute returns the first route whose path prefixes the request
+// path or nil. Only idempotent requests are hedged.
+func matchHedgeRoute(routes []*hedgeRoute, r *http.Request) *hedgeRoute {
+	if !isIdempotent(r.Method) {
+		return nil
+	}
+
+	for _, route := range routes {
+		if strings.HasPrefix(r.URL.Path, route.path) {
+			return route
+		}
+	}
+
+	return nil
+}
+
+// hedgeDelay is the observed p95 once enough latencies were seen, the
+// configured delay otherwise.
+func (hr *hedgeRoute) hedgeDelay() time.Duration {
+	if p95 := hr.p95.Load(); hr.useP95 && p95 > 0 {
+		return time.Duration(p95)
+	}
+	return hr.delay
+}
+
+func (hr *hedgeRoute) observe(latency time.Duration) {
+	if !hr.useP95 {
+		return
+	}
+
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+
+	if hr.samples == nil {
+		hr.samples = make([]time.Duration, 0, hedgeWindow)
+	}
+
+	if len(hr.samples) < hedgeWindow {
+		hr.samples = append(hr.samples, latency)
+	} else {
+		hr.samples[hr.pos] = latency
+		hr.pos = (hr.pos + 1) % hedgeWindow
+	}
+	hr.seen++
+
+	if len(hr.samples) >= hedgeMinSamples && hr.seen%hedgeRecompute == 0 {
+		sorted := slices.Clone(hr.samples)
+		slices.Sort(sorted)
+		hr.p95.Store(int64(sorted[len(sorted)*95/100]))
+	}
+}
+
+type hedgeResult struct {
+	resp   *http.Response
+	server *server.Backend
+	err    error
+	index  int // 0 for the first attempt
+}
+
+// hedge sends r to first and, every time no response arrived within the
+// route's delay, duplicates it to another untried backend up to maxHedges
+// times. The first response wins and the other attempts are canceled
+// through their contexts.
+func (b *balancerHandler) hedge(r *http.Request, body []byte, first *server.Backend, sel *SelectContext, route *hedgeRoute) (*http.Response, *server.Backend, error) {
+	results := make(chan hedgeResult, route.maxHedges+1)
+	cancels := make([]context.CancelFunc, 0, route.maxHedges+1)
+	start := time.Now()
+
+	launch := func(srv *server.Backend) {
+		ctx, cancel := context.WithCancel(r.Context())
+		index := len(cancels)
+		cancels = append(cancels, cancel)
+
+		go func() {
+			resp, err := b.send(r.WithContext(ctx), bytes.NewReader(body), srv)
+			results <- hedgeResult{resp: resp, server: srv, err: err, index: index}
+		}()
+	}
+
+	launch(first)
+	pending, hedges := 1, 0
+
+	timer := time.NewTimer(route.hedgeDelay())
+	defer timer.Stop()
+
+	// Hedged backends count as tried, so hedges and retries avoid them.
+	tried := append(slices.Clone(sel.Tried), first)
+
+	var lastErr error
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			hedgeSel := &SelectContext{
+				Request:  sel.Request,
+				ClientIP: sel.ClientIP,
+				HashKey:  sel.HashKey,
+				Attempt:  sel.Attempt,
+				Tried:    tried,
+				cursor:   sel.cursor,
+			}
+			next := b.selectServer(hedgeSel)
+			sel.cursor = hedgeSel.cursor
+			if next == nil {
+				continue
+			}
+
+			b.log.Debug("hedging request", slog.String("path", r.URL.Path), slog.String("server", next.URL))
+			metrics.HedgeSent(route.path)
+
+			tried = append(tried, next)
+			launch(next)
+			pending++
+			hedges++
+
+			if hedges < route.maxHedges {
+				timer.Reset(route.hedgeDelay())
+			}
+		case res := <-results:
+			pending--
+			if res.err != nil {
+				cancels[res.index]()
+				lastErr = res.err
+				continue
+			}
+
+			route.observe(time.Since(start))
+			if res.index > 0 {
+				metrics.HedgeWon(route.path)
+			}
+
+			for i, cancel := range cancels {
+				if i != res.index {
+					cancel()
+				}
+			}
+			go discardHedges(results, pending)
+
+			// Keep the winner's context alive until its body is closed.
+			res.resp.Body = &cancelBody{ReadCloser: res.resp.Body, cancel: cancels[res.index]}
+
+			return res.resp, res.server, nil
+		}
+	}
+
+	// Every attempt failed, the hedged backends count as tried for retries.
+	// The first one is added by the caller.
+	sel.Tried = append(sel.Tried, tried[len(sel.Tried)+1:]...)
+
+	return nil, first, lastErr
+}
+
+// discardHedges releases the responses of the attempts that lost.
+func discardHedges(results <-chan hedgeResult, pending int) {
+	for ; pending > 0; pending-- {
+		res := <-results
+		if res.err == nil {
+			res.resp.Body.Close()
+			res.server.DecrementConnections()
+		}
+	}
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,244 @@
+package balancer
+
+import (
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// answerAfter responds with the name of the backend after delay, or gives up
+// and reports on canceled when the request is canceled first.
+func answerAfter(name string, delay time.Duration, canceled chan<- string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+			io.WriteString(w, name)
+		case <-r.Context().Done():
+			if canceled != nil {
+				canceled <- name
+			}
+		}
+	}
+}
+
+// get sends a GET to path through front and returns the response body.
+func get(t *testing.T, front, path string) string {
+	t.Helper()
+
+	resp, err := http.Get(front + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestHedgeFiresAfterDelay(t *testing.T) {
+	arrived := make(chan time.Time, 2)
+	record := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			arrived <- time.Now()
+			next(w, r)
+		}
+	}
+
+	delay := 100 * time.Millisecond
+	front, backends := newTestCluster(t, func(cfg *config.Config) {
+		cfg.Hedging.Routes = []config.HedgeRoute{{Path: "/", Delay: delay}}
+	}, record(answerAfter("a", time.Second, nil)), record(answerAfter("b", 0, nil)))
+
+	if got := get(t, front.URL, "/"); got != "b" {
+		t.Fatalf("response from %q, want the hedge to b", got)
+	}
+
+	first, hedged := <-arrived, <-arrived
+	if gap := hedged.Sub(first); gap < delay*9/10 {
+		t.Errorf("hedge was sent %s after the first attempt, want %s", gap, delay)
+	}
+
+	// A response within the delay is not hedged.
+	if got := get(t, front.URL, "/"); got != "b" {
+		t.Fatalf("response from %q, want b", got)
+	}
+	if got := hits(backends); got[0] != 1 || got[1] != 2 {
+		t.Errorf("hits = %v, want [1 2]", got)
+	}
+}
+
+func TestHedgeFirstResponseWins(t *testing.T) {
+	tests := []struct {
+		name   string
+		a, b   time.Duration // response times of the backends
+		winner string
+		loser  string
+	}{
+		{name: "hedge wins", a: time.Second, b: 0, winner: "b", loser: "a"},
+		{name: "first attempt wins", a: 100 * time.Millisecond, b: time.Second, winner: "a", loser: "b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			canceled := make(chan string, 2)
+			front, backends := newTestCluster(t, func(cfg *config.Config) {
+				cfg.Hedging.Routes = []config.HedgeRoute{{Path: "/", Delay: 20 * time.Millisecond}}
+			}, answerAfter("a", tt.a, canceled), answerAfter("b", tt.b, canceled))
+
+			if got := get(t, front.URL, "/"); got != tt.winner {
+				t.Fatalf("response from %q, want %q", got, tt.winner)
+			}
+
+			select {
+			case got := <-canceled:
+				if got != tt.loser {
+					t.Errorf("%s was canceled, want %s", got, tt.loser)
+				}
+			case <-time.After(time.Second / 2):
+				t.Fatalf("%s was not canceled", tt.loser)
+			}
+
+			waitFor(t, func() bool {
+				return backends[0].CurrentConnections() == 0 && backends[1].CurrentConnections() == 0
+			})
+		})
+	}
+}
+
+func TestHedgeRespectsMaxHedges(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxHedges int
+		wantHits  int64
+	}{
+		{name: "default", maxHedges: 0, wantHits: 2},
+		{name: "one", maxHedges: 1, wantHits: 2},
+		{name: "two", maxHedges: 2, wantHits: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slow := answerAfter("slow", 200*time.Millisecond, nil)
+			front, backends := newTestCluster(t, func(cfg *config.Config) {
+				cfg.Hedging.Routes = []config.HedgeRoute{{Path: "/", Delay: 10 * time.Millisecond, MaxHedges: tt.maxHedges}}
+			}, slow, slow, slow, slow)
+
+			get(t, front.URL, "/")
+
+			var total int64
+			for _, n := range hits(backends) {
+				total += n
+			}
+			if total != tt.wantHits {
+				t.Errorf("backends got %d requests, want %d", total, tt.wantHits)
+			}
+		})
+	}
+}
+
+func TestHedgeCounters(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		a, b     time.Duration
+		wantSent float64
+		wantWon  float64
+	}{
+		{name: "hedge wins", path: "/won", a: time.Second, b: 0, wantSent: 1, wantWon: 1},
+		{name: "hedge loses", path: "/lost", a: 100 * time.Millisecond, b: time.Second, wantSent: 1, wantWon: 0},
+		{name: "not hedged", path: "/fast", a: 0, b: 0, wantSent: 0, wantWon: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			front, _ := newTestCluster(t, func(cfg *config.Config) {
+				cfg.Hedging.Routes = []config.HedgeRoute{{Path: tt.path, Delay: 20 * time.Millisecond}}
+			}, answerAfter("a", tt.a, nil), answerAfter("b", tt.b, nil))
+
+			// The counters are global, only their increments are checked.
+			sent := hedgeCounter(t, "hedged_requests_sent_total", tt.path)
+			won := hedgeCounter(t, "hedged_requests_won_total", tt.path)
+
+			get(t, front.URL, tt.path)
+
+			if got := hedgeCounter(t, "hedged_requests_sent_total", tt.path) - sent; got != tt.wantSent {
+				t.Errorf("sent = %v, want %v", got, tt.wantSent)
+			}
+			if got := hedgeCounter(t, "hedged_requests_won_total", tt.path) - won; got != tt.wantWon {
+				t.Errorf("won = %v, want %v", got, tt.wantWon)
+			}
+		})
+	}
+}
+
+// hedgeCounter returns the value of a hedge counter of route, 0 if it was
+// never incremented.
+func hedgeCounter(t *testing.T, name, route string) float64 {
+	t.Helper()
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "route" && label.GetValue() == route {
+					return m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+
+	return 0
+}
+
+func TestHedgeDelayUsesP95(t *testing.T) {
+	route := newHedgeRoutes(config.Hedging{Routes: []config.HedgeRoute{{Path: "/", Delay: 50 * time.Millisecond, UseP95: true}}})[0]
+
+	observe := func(from, to int) {
+		for i := from; i <= to; i++ {
+			route.observe(time.Duration(i) * time.Millisecond)
+		}
+	}
+
+	// The p95 is recomputed every hedgeRecompute latencies.
+	observe(1, hedgeRecompute-1)
+	if got := route.hedgeDelay(); got != 50*time.Millisecond {
+		t.Fatalf("delay = %s before the p95 is known, want the configured 50ms", got)
+	}
+
+	observe(hedgeRecompute, hedgeRecompute)
+	if got, want := route.hedgeDelay(), time.Duration(hedgeRecompute*95/100+1)*time.Millisecond; got != want {
+		t.Errorf("delay = %s, want the p95 %s", got, want)
+	}
+
+	// Once the window is full the oldest latencies are replaced.
+	observe(hedgeRecompute+1, hedgeWindow+hedgeRecompute)
+	if got, want := route.hedgeDelay(), time.Duration(hedgeRecompute+hedgeWindow*95/100+1)*time.Millisecond; got != want {
+		t.Errorf("delay = %s, want the p95 of the latest window %s", got, want)
+	}
+}
+
+func TestHedgeDelayIgnoresLatenciesWithoutP95(t *testing.T) {
+	route := newHedgeRoutes(config.Hedging{Routes: []config.HedgeRoute{{Path: "/"}}})[0]
+
+	for range hedgeWindow {
+		route.observe(time.Second)
+	}
+
+	if got := route.hedgeDelay(); got != defaultHedgeDelay {
+		t.Errorf("delay = %s, want the default %s", got, defaultHedgeDelay)
+	}
+}
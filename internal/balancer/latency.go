@@ -0,0 +1,128 @@
+package balancer
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// failurePenalty is recorded instead of the latency of failed requests,
+// otherwise a server refusing connections looks like the fastest one.
+const failurePenalty = time.Second
+
+// defaultLatency is assumed for every backend until any is observed, so
+// in-flight requests still rank them.
+const defaultLatency = 100 * time.Millisecond
+
+// ewma is an exponentially weighted moving average of response latencies
+// whose weight decays with the time between observations. With peak set,
+// latencies above the average replace it immediately, so a slowing server is
+// penalized at once and recovers gradually.
+type ewma struct {
+	mu    sync.Mutex // serializes observe, get is lock-free
+	last  atomic.Pointer[ewmaSample]
+	decay time.Duration
+	peak  bool
+}
+
+type ewmaSample struct {
+	value float64 // nanoseconds
+	stamp time.Time
+}
+
+// observe records rtt and returns the average before and after it, first is
+// set for the first observation.
+func (e *ewma) observe(rtt time.Duration, now time.Time) (before, after float64, first bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	sample := float64(rtt)
+	after = sample
+
+	last := e.last.Load()
+	if last != nil {
+		before = last.value
+		if w := e.weight(last, now); !e.peak || sample <= before*w {
+			after = before*w + sample*(1-w)
+		}
+	}
+
+	e.last.Store(&ewmaSample{value: after, stamp: now})
+
+	return before, after, last == nil
+}
+
+// get returns the average in nanoseconds at now. Without new observations it
+// decays towards 0 at the same rate, so a server with an old spike is tried
+// again once its average falls below the ones of the servers getting traffic.
+// ok is false until the first observation.
+func (e *ewma) get(now time.Time) (value float64, ok bool) {
+	last := e.last.Load()
+	if last == nil {
+		return 0, false
+	}
+	return last.value * e.weight(last, now), true
+}
+
+// weight is the share of the last average left at now.
+func (e *ewma) weight(last *ewmaSample, now time.Time) float64 {
+	return math.Exp(-float64(max(now.Sub(last.stamp), 0)) / float64(e.decay))
+}
+
+// latencyTracker keeps a moving average of latencies per backend ID. The
+// state survives servers going down and coming back.
+type latencyTracker struct {
+	stats sync.Map // backend ID -> *ewma
+	decay time.Duration
+	peak  bool
+
+	mu   sync.Mutex // guards sum and n
+	sum  float64    // of the averages of the observed backends
+	n    int
+	mean atomic.Uint64 // float64 bits of sum / n, defaultLatency before any observation
+}
+
+func newLatencyTracker(decay time.Duration, peak bool) *latencyTracker {
+	lt := &latencyTracker{
+		decay: decay,
+		peak:  peak,
+	}
+	lt.mean.Store(math.Float64bits(float64(defaultLatency)))
+
+	return lt
+}
+
+func (lt *latencyTracker) observe(id string, rtt time.Duration, err error) {
+	if err != nil && rtt < failurePenalty {
+		rtt = failurePenalty
+	}
+
+	stat, ok := lt.stats.Load(id)
+	if !ok {
+		stat, _ = lt.stats.LoadOrStore(id, &ewma{decay: lt.decay, peak: lt.peak})
+	}
+
+	before, after, first := stat.(*ewma).observe(rtt, time.Now())
+
+	lt.mu.Lock()
+	if first {
+		lt.n++
+	}
+	lt.sum += after - before
+	lt.mean.Store(math.Float64bits(lt.sum / float64(lt.n)))
+	lt.mu.Unlock()
+}
+
+// latency returns the current average of the backend in nanoseconds. Backends
+// not observed yet get the mean of the others, so they don't win every
+// comparison until their first response.
+func (lt *latencyTracker) latency(id string) float64 {
+	if stat, ok := lt.stats.Load(id); ok {
+		if value, ok := stat.(*ewma).get(time.Now()); ok {
+			return value
+		}
+	}
+
+	return math.Float64frombits(lt.mean.Load())
+}
@@ -1,76 +1,50 @@
 package balancer
 
 import (
-	"sync"
+	"sync/atomic"
 
 	"github.com/dzhordano/balancer-go/internal/server"
 )
 
 type LeastConnectionsBalancer struct {
-	mu           sync.Mutex
-	downServers  []server.Server
-	aliveServers []server.Server
+	alive     atomic.Pointer[serverList]
+	less      func(a, b *server.Backend) bool // reports whether a is a better choice than b (default: fewer connections)
+	weighted  bool                            // connections are compared per unit of weight
+	slowStart *slowStart
 }
 
-func (lc *LeastConnectionsBalancer) SetServers(servers []server.Server) {
-	lc.aliveServers = servers
+// NewWeightedLeastConnectionsBalancer picks the server with the fewest
+// connections per unit of weight.
+func NewWeightedLeastConnectionsBalancer() *LeastConnectionsBalancer {
+	return &LeastConnectionsBalancer{less: lessWeightedConnections, weighted: true}
 }
 
-func (lc *LeastConnectionsBalancer) SelectServer(args ...interface{}) *server.Server {
-	lc.mu.Lock()
-	defer lc.mu.Unlock()
+func (lc *LeastConnectionsBalancer) SetServers(servers []*server.Backend) {
+	lc.alive.Store(&serverList{servers: servers})
+}
 
-	if len(lc.aliveServers) == 0 {
+func (lc *LeastConnectionsBalancer) SelectServer(ctx *SelectContext) *server.Backend {
+	alive := lc.alive.Load()
+	if alive == nil {
 		return nil
 	}
 
-	minConns := int(^uint(0) >> 1) // Max Int
-	var server *server.Server
+	less := lc.less
+	if less == nil {
+		less = lessConnections
+	}
+	less = lc.slowStart.lessConnections(less, lc.weighted)
 
-	for _, srv := range lc.aliveServers {
-		currConns := int(srv.CurrentConnections())
+	var server *server.Backend
+	for _, srv := range alive.servers {
+		if ctx.WasTried(srv) {
+			continue
+		}
 
-		if currConns < minConns {
-			minConns = currConns
-			server = &srv
+		if server == nil || less(srv, server) {
+			server = srv
 		}
 	}
 
 	return server
 }
-
-func (lc *LeastConnectionsBalancer) DownServers() []server.Server {
-	lc.mu.Lock()
-	defer lc.mu.Unlock()
-	return lc.downServers
-}
-
-func (lc *LeastConnectionsBalancer) RemoveAliveServer(index int) {
-	lc.mu.Lock()
-	defer lc.mu.Unlock()
-	lc.aliveServers = append(lc.aliveServers[:index], lc.aliveServers[index+1:]...)
-}
-
-func (lc *LeastConnectionsBalancer) RemoveDownServer(index int) {
-	lc.mu.Lock()
-	defer lc.mu.Unlock()
-	lc.downServers = append(lc.downServers[:index], lc.downServers[index+1:]...)
-}
-
-func (lc *LeastConnectionsBalancer) AddAliveServer(server server.Server) {
-	lc.mu.Lock()
-	defer lc.mu.Unlock()
-	lc.aliveServers = append(lc.aliveServers, server)
-}
-
-func (lc *LeastConnectionsBalancer) AddDownServer(server server.Server) {
-	lc.mu.Lock()
-	defer lc.mu.Unlock()
-	lc.downServers = append(lc.downServers, server)
-}
-
-func (lc *LeastConnectionsBalancer) AliveServers() []server.Server {
-	lc.mu.Lock()
-	defer lc.mu.Unlock()
-	return lc.aliveServers
-}
@@ -0,0 +1,73 @@
+package balancer
+
+import (
+	"testing"
+
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+func TestLeastConnections(t *testing.T) {
+	servers := newWeightedServers(1, 1, 1)
+	withConnections(servers[0], 2)
+	withConnections(servers[1], 1)
+	withConnections(servers[2], 3)
+
+	lc := &LeastConnectionsBalancer{}
+	lc.SetServers(servers)
+
+	if srv := lc.SelectServer(&SelectContext{}); srv != servers[1] {
+		t.Errorf("selected %s, want b with the fewest connections", srv.ID)
+	}
+
+	ctx := &SelectContext{Tried: []*server.Backend{servers[1]}}
+	if srv := lc.SelectServer(ctx); srv != servers[0] {
+		t.Errorf("selected %s after b was tried, want a", srv.ID)
+	}
+}
+
+func TestWeightedLeastConnections(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []int
+		conns   []int
+		want    string
+	}{
+		// (conns+1)/weight: 4/4 = 1 is below 2/1 = 2.
+		{name: "heavier takes more", weights: []int{4, 1}, conns: []int{3, 1}, want: "a"},
+		// 5/4 is above 1/1.
+		{name: "heavier is full", weights: []int{4, 1}, conns: []int{4, 0}, want: "b"},
+		{name: "equal weights compare connections", weights: []int{2, 2}, conns: []int{2, 1}, want: "b"},
+		{name: "unset weight counts as 1", weights: []int{0, 2}, conns: []int{1, 1}, want: "b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			servers := newWeightedServers(tt.weights...)
+			for i, n := range tt.conns {
+				withConnections(servers[i], n)
+			}
+
+			lc := NewWeightedLeastConnectionsBalancer()
+			lc.SetServers(servers)
+
+			if srv := lc.SelectServer(&SelectContext{}); srv.ID != tt.want {
+				t.Errorf("selected %s, want %s", srv.ID, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeightedLeastConnectionsShare(t *testing.T) {
+	servers := newWeightedServers(3, 1)
+	lc := NewWeightedLeastConnectionsBalancer()
+	lc.SetServers(servers)
+
+	// Requests that stay in flight fill the servers by weight.
+	for range 8 {
+		lc.SelectServer(&SelectContext{}).IncrementConnections()
+	}
+
+	if a, b := servers[0].CurrentConnections(), servers[1].CurrentConnections(); a != 6 || b != 2 {
+		t.Errorf("connections a = %d, b = %d, want 6 and 2", a, b)
+	}
+}
@@ -0,0 +1,44 @@
+package balancer
+
+import (
+	"time"
+
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+const defaultLeastResponseTimeDecay = 10 * time.Second
+
+// LeastResponseTimeBalancer picks the server with the lowest average response
+// time multiplied by its active connections, ties go to the heavier server.
+type LeastResponseTimeBalancer struct {
+	*LeastConnectionsBalancer
+	latencies *latencyTracker
+}
+
+func NewLeastResponseTimeBalancer(decay time.Duration) *LeastResponseTimeBalancer {
+	if decay <= 0 {
+		decay = defaultLeastResponseTimeDecay
+	}
+
+	lrt := &LeastResponseTimeBalancer{latencies: newLatencyTracker(decay, false)}
+	lrt.LeastConnectionsBalancer = &LeastConnectionsBalancer{less: func(a, b *server.Backend) bool {
+		scoreA, scoreB := lrt.score(a), lrt.score(b)
+		if scoreA == scoreB {
+			return serverWeight(a) > serverWeight(b)
+		}
+		return scoreA < scoreB
+	}}
+
+	return lrt
+}
+
+func (lrt *LeastResponseTimeBalancer) Observe(srv *server.Backend, rtt time.Duration, err error) {
+	lrt.latencies.observe(srv.ID, rtt, err)
+}
+
+// score counts the request being balanced, so idle servers are still ranked
+// by their response time. Servers not observed yet are scored with the mean
+// response time of the others, so in-flight requests still count for them.
+func (lrt *LeastResponseTimeBalancer) score(srv *server.Backend) float64 {
+	return lrt.latencies.latency(srv.ID) * float64(srv.CurrentConnections()+1)
+}
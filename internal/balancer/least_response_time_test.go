@@ -0,0 +1,98 @@
+package balancer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+// withConnections sets the in-flight requests of srv to n.
+func withConnections(srv *server.Backend, n int) {
+	for range n {
+		srv.IncrementConnections()
+	}
+}
+
+func TestLeastResponseTimeScore(t *testing.T) {
+	servers := newWeightedServers(1, 1)
+	lrt := NewLeastResponseTimeBalancer(time.Minute)
+	lrt.SetServers(servers)
+
+	lrt.Observe(servers[0], 10*time.Millisecond, nil)
+	lrt.Observe(servers[1], 30*time.Millisecond, nil)
+
+	// Idle servers are ranked by their response time.
+	if got := picks(lrt, 3); got != "a,a,a" {
+		t.Errorf("picks = %s, want the faster a", got)
+	}
+
+	// 10ms x (3+1) is above 30ms x (0+1).
+	withConnections(servers[0], 3)
+	if got := picks(lrt, 3); got != "b,b,b" {
+		t.Errorf("picks = %s, want b once a is loaded", got)
+	}
+}
+
+func TestLeastResponseTimeTiesGoToHeavier(t *testing.T) {
+	servers := newWeightedServers(1, 3)
+	lrt := NewLeastResponseTimeBalancer(time.Minute)
+	lrt.SetServers(servers)
+
+	// Neither is observed, both get the same latency.
+	if srv := lrt.SelectServer(&SelectContext{}); srv != servers[1] {
+		t.Errorf("selected %s, want the heavier b", srv.ID)
+	}
+}
+
+func TestLeastResponseTimeColdStart(t *testing.T) {
+	servers := newWeightedServers(1, 1, 1)
+	lrt := NewLeastResponseTimeBalancer(time.Minute)
+	lrt.SetServers(servers)
+
+	lrt.Observe(servers[0], 5*time.Millisecond, nil)
+	lrt.Observe(servers[1], 5*time.Millisecond, nil)
+
+	// c was never observed, but has requests in flight.
+	withConnections(servers[2], 50)
+
+	if counts := countPicks(lrt, 100); counts["c"] != 0 {
+		t.Errorf("unobserved c with 50 requests in flight was picked %d times over idle servers", counts["c"])
+	}
+
+	// Idle, it is as good as the mean of the others.
+	for range 50 {
+		servers[2].DecrementConnections()
+	}
+	withConnections(servers[0], 1)
+	withConnections(servers[1], 1)
+	if srv := lrt.SelectServer(&SelectContext{}); srv != servers[2] {
+		t.Errorf("selected %s, want the idle unobserved c", srv.ID)
+	}
+}
+
+func TestLeastResponseTimeNothingObserved(t *testing.T) {
+	servers := newWeightedServers(1, 1)
+	lrt := NewLeastResponseTimeBalancer(time.Minute)
+	lrt.SetServers(servers)
+
+	// Without latencies connections decide.
+	withConnections(servers[0], 2)
+	if got := picks(lrt, 3); got != "b,b,b" {
+		t.Errorf("picks = %s, want the idle b", got)
+	}
+}
+
+func TestLeastResponseTimeSkipsTried(t *testing.T) {
+	servers := newWeightedServers(1, 1)
+	lrt := NewLeastResponseTimeBalancer(time.Minute)
+	lrt.SetServers(servers)
+
+	lrt.Observe(servers[0], time.Millisecond, nil)
+	lrt.Observe(servers[1], time.Second, nil)
+
+	ctx := &SelectContext{Tried: []*server.Backend{servers[0]}}
+	if srv := lrt.SelectServer(ctx); srv != servers[1] {
+		t.Errorf("selected %s, want the untried b", srv.ID)
+	}
+}
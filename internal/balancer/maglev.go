@@ -0,0 +1,118 @@
+package balancer
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/big"
+	"sync/atomic"
+
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+const defaultMaglevTableSize = 65537
+
+// MaglevBalancer picks servers through a precomputed Maglev lookup table. The
+// table is rebuilt whenever the alive set changes, so selection is a single
+// lock-free table lookup.
+type MaglevBalancer struct {
+	tableSize uint64
+	table     atomic.Pointer[maglevTable]
+}
+
+type maglevTable struct {
+	servers []*server.Backend
+	lookup  []int32
+}
+
+func NewMaglevBalancer(tableSize uint64) (*MaglevBalancer, error) {
+	if tableSize == 0 {
+		tableSize = defaultMaglevTableSize
+	}
+
+	if !big.NewInt(0).SetUint64(tableSize).ProbablyPrime(0) {
+		return nil, fmt.Errorf("maglev table size %d is not a prime number", tableSize)
+	}
+
+	return &MaglevBalancer{tableSize: tableSize}, nil
+}
+
+func (mb *MaglevBalancer) SetServers(servers []*server.Backend) {
+	mb.table.Store(mb.build(servers))
+}
+
+// SelectServer looks the hash key up in the table. Retries probe the
+// following slots until they hit a backend that was not tried.
+func (mb *MaglevBalancer) SelectServer(ctx *SelectContext) *server.Backend {
+	table := mb.table.Load()
+	if table == nil || len(table.servers) == 0 {
+		return nil
+	}
+
+	m := uint64(len(table.lookup))
+	slot := maglevHash(ctx.HashKey, 0) % m
+
+	srv := table.servers[table.lookup[slot]]
+	if len(ctx.Tried) == 0 {
+		return srv
+	}
+
+	for i := uint64(1); ctx.WasTried(srv) && i < m; i++ {
+		srv = table.servers[table.lookup[(slot+i)%m]]
+	}
+
+	if ctx.WasTried(srv) {
+		return nil
+	}
+
+	return srv
+}
+
+// build populates a lookup table as described in the Maglev paper. Servers
+// with a bigger weight take more turns per round.
+func (mb *MaglevBalancer) build(servers []*server.Backend) *maglevTable {
+	table := &maglevTable{servers: servers}
+	if len(servers) == 0 {
+		return table
+	}
+
+	m := mb.tableSize
+	offsets := make([]uint64, len(servers))
+	skips := make([]uint64, len(servers))
+	next := make([]uint64, len(servers))
+	for i := range servers {
+		offsets[i] = maglevHash(servers[i].ID, 1) % m
+		skips[i] = maglevHash(servers[i].ID, 2)%(m-1) + 1
+	}
+
+	table.lookup = make([]int32, m)
+	for i := range table.lookup {
+		table.lookup[i] = -1
+	}
+
+	var filled uint64
+	for filled < m {
+		for i := range servers {
+			weight := serverWeight(servers[i])
+			for turn := 0; turn < weight && filled < m; turn++ {
+				c := (offsets[i] + next[i]*skips[i]) % m
+				for table.lookup[c] >= 0 {
+					next[i]++
+					c = (offsets[i] + next[i]*skips[i]) % m
+				}
+
+				table.lookup[c] = int32(i)
+				next[i]++
+				filled++
+			}
+		}
+	}
+
+	return table
+}
+
+func maglevHash(key string, seed byte) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte{seed})
+	h.Write([]byte(key))
+	return mix64(h.Sum64())
+}
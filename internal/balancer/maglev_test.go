@@ -0,0 +1,118 @@
+package balancer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+// hashKeys are the keys the hashing benchmarks select with.
+var hashKeys = func() []string {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("10.0.%d.%d", i/256, i%256)
+	}
+	return keys
+}()
+
+type namedBalancer struct {
+	name string
+	Balancer
+}
+
+func newHashingBalancers(b *testing.B) []namedBalancer {
+	b.Helper()
+
+	maglev, err := NewMaglevBalancer(defaultMaglevTableSize)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return []namedBalancer{
+		{name: "maglev", Balancer: maglev},
+		{name: "hash", Balancer: &HashBalancer{}},
+	}
+}
+
+func BenchmarkHashingSelect(b *testing.B) {
+	for _, n := range []int{3, 20, 100} {
+		servers := newRingServers(n)
+
+		for _, balancer := range newHashingBalancers(b) {
+			balancer.SetServers(servers)
+
+			b.Run(fmt.Sprintf("%s/servers=%d", balancer.name, n), func(b *testing.B) {
+				ctx := &SelectContext{}
+				for i := range b.N {
+					ctx.HashKey = hashKeys[i%len(hashKeys)]
+					if balancer.SelectServer(ctx) == nil {
+						b.Fatal("no server selected")
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkHashingSelectRetry(b *testing.B) {
+	servers := newRingServers(20)
+
+	for _, balancer := range newHashingBalancers(b) {
+		balancer.SetServers(servers)
+
+		b.Run(balancer.name, func(b *testing.B) {
+			for i := range b.N {
+				ctx := &SelectContext{HashKey: hashKeys[i%len(hashKeys)]}
+				ctx.Tried = append(ctx.Tried, balancer.SelectServer(ctx))
+				if balancer.SelectServer(ctx) == nil {
+					b.Fatal("no server selected")
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkHashingSetServers measures the rebuild on membership changes,
+// which runs off the request path.
+func BenchmarkHashingSetServers(b *testing.B) {
+	for _, n := range []int{3, 20, 100} {
+		servers := newRingServers(n)
+
+		for _, balancer := range newHashingBalancers(b) {
+			b.Run(fmt.Sprintf("%s/servers=%d", balancer.name, n), func(b *testing.B) {
+				for range b.N {
+					balancer.SetServers(servers)
+				}
+			})
+		}
+	}
+}
+
+func TestMaglevDistribution(t *testing.T) {
+	servers := newRingServers(7)
+	servers[0].Weight = 2
+
+	mb, err := NewMaglevBalancer(defaultMaglevTableSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mb.SetServers(servers)
+
+	counts := make(map[*server.Backend]int)
+	for _, i := range mb.table.Load().lookup {
+		counts[servers[i]]++
+	}
+
+	// Weight 2 of a total of 8 owns a quarter of the slots, the others an
+	// eighth each.
+	for i, srv := range servers {
+		want := float64(defaultMaglevTableSize) / 8
+		if i == 0 {
+			want *= 2
+		}
+		if got := float64(counts[srv]); got < want*0.95 || got > want*1.05 {
+			t.Errorf("%s owns %.0f slots, want about %.0f", srv.ID, got, want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package balancer
+
+import (
+	"math/rand/v2"
+	"sync/atomic"
+
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+// P2CBalancer implements the power of two choices: it samples two random
+// alive servers and picks the one with fewer in-flight requests. The weighted
+// variant compares in-flight requests per unit of weight.
+type P2CBalancer struct {
+	alive     atomic.Pointer[serverList]
+	less      func(a, b *server.Backend) bool // reports whether a is a better choice than b
+	weighted  bool
+	slowStart *slowStart
+}
+
+func NewP2CBalancer(weighted bool) *P2CBalancer {
+	if weighted {
+		return &P2CBalancer{less: lessWeightedConnections, weighted: true}
+	}
+	return &P2CBalancer{less: lessConnections}
+}
+
+func (pb *P2CBalancer) SetServers(servers []*server.Backend) {
+	pb.alive.Store(&serverList{servers: servers})
+}
+
+func (pb *P2CBalancer) SelectServer(ctx *SelectContext) *server.Backend {
+	alive := pb.alive.Load()
+	if alive == nil {
+		return nil
+	}
+
+	servers := ctx.untried(alive.servers)
+
+	n := len(servers)
+	switch n {
+	case 0:
+		return nil
+	case 1:
+		return servers[0]
+	}
+
+	i := rand.IntN(n)
+	j := rand.IntN(n - 1)
+	if j >= i {
+		j++
+	}
+
+	a, b := servers[i], servers[j]
+	if pb.slowStart.lessConnections(pb.less, pb.weighted)(b, a) {
+		return b
+	}
+
+	return a
+}
+
+func lessConnections(a, b *server.Backend) bool {
+	return a.CurrentConnections() < b.CurrentConnections()
+}
+
+// lessWeightedConnections compares (conns+1)/weight, cross-multiplied to stay
+// in integers.
+func lessWeightedConnections(a, b *server.Backend) bool {
+	return (a.CurrentConnections()+1)*int64(serverWeight(b)) < (b.CurrentConnections()+1)*int64(serverWeight(a))
+}
@@ -0,0 +1,89 @@
+package balancer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+// BenchmarkP2C selects servers and holds a connection to them from every
+// goroutine. Compare GOMAXPROCS with:
+//
+//	go test ./internal/balancer -run XXX -bench P2C -cpu 1,2,4,8
+//
+// p2c reads two shared counters per pick, least_connections scans them all.
+func BenchmarkP2C(b *testing.B) {
+	for _, n := range []int{10, 100} {
+		servers := newRingServers(n)
+
+		for _, balancer := range []namedBalancer{
+			{name: "p2c", Balancer: NewP2CBalancer(false)},
+			{name: "weighted_p2c", Balancer: NewP2CBalancer(true)},
+			{name: "least_connections", Balancer: &LeastConnectionsBalancer{}},
+		} {
+			balancer.SetServers(servers)
+
+			b.Run(fmt.Sprintf("%s/servers=%d", balancer.name, n), func(b *testing.B) {
+				b.RunParallel(func(pb *testing.PB) {
+					ctx := &SelectContext{}
+					for pb.Next() {
+						srv := balancer.SelectServer(ctx)
+						srv.IncrementConnections()
+						srv.DecrementConnections()
+					}
+				})
+			})
+		}
+	}
+}
+
+func TestP2CPicksLessLoaded(t *testing.T) {
+	servers := newRingServers(2)
+	for range 5 {
+		servers[0].IncrementConnections()
+	}
+
+	pb := NewP2CBalancer(false)
+	pb.SetServers(servers)
+
+	// With two servers both are always sampled.
+	for range 100 {
+		if srv := pb.SelectServer(&SelectContext{}); srv != servers[1] {
+			t.Fatalf("selected %s with 5 connections over an idle server", srv.ID)
+		}
+	}
+}
+
+func TestWeightedP2CComparesPerWeight(t *testing.T) {
+	servers := newRingServers(2)
+	servers[0].Weight = 4
+	for range 3 {
+		servers[0].IncrementConnections()
+	}
+	servers[1].IncrementConnections()
+
+	pb := NewP2CBalancer(true)
+	pb.SetServers(servers)
+
+	// (3+1)/4 = 1 is below (1+1)/1 = 2.
+	for range 100 {
+		if srv := pb.SelectServer(&SelectContext{}); srv != servers[0] {
+			t.Fatalf("selected %s, want the heavier weighted server", srv.ID)
+		}
+	}
+}
+
+func TestP2CSkipsTried(t *testing.T) {
+	servers := newRingServers(3)
+
+	pb := NewP2CBalancer(false)
+	pb.SetServers(servers)
+
+	ctx := &SelectContext{Tried: []*server.Backend{servers[0], servers[1]}}
+	for range 100 {
+		if srv := pb.SelectServer(ctx); srv != servers[2] {
+			t.Fatalf("selected tried server %s", srv.ID)
+		}
+	}
+}
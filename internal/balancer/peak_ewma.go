@@ -0,0 +1,37 @@
+package balancer
+
+import (
+	"time"
+
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+const defaultPeakEWMADecay = 10 * time.Second
+
+// PeakEWMABalancer picks between two random servers the one with the lower
+// peak EWMA latency multiplied by its in-flight requests.
+type PeakEWMABalancer struct {
+	*P2CBalancer
+	latencies *latencyTracker
+}
+
+func NewPeakEWMABalancer(decay time.Duration) *PeakEWMABalancer {
+	if decay <= 0 {
+		decay = defaultPeakEWMADecay
+	}
+
+	pe := &PeakEWMABalancer{latencies: newLatencyTracker(decay, true)}
+	pe.P2CBalancer = &P2CBalancer{less: func(a, b *server.Backend) bool {
+		return pe.score(a) < pe.score(b)
+	}}
+
+	return pe
+}
+
+func (pe *PeakEWMABalancer) Observe(srv *server.Backend, rtt time.Duration, err error) {
+	pe.latencies.observe(srv.ID, rtt, err)
+}
+
+func (pe *PeakEWMABalancer) score(srv *server.Backend) float64 {
+	return pe.latencies.latency(srv.ID) * float64(srv.CurrentConnections()+1)
+}
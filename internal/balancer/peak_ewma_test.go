@@ -0,0 +1,124 @@
+package balancer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countPicks selects n servers and returns how often each ID was selected.
+func countPicks(b Balancer, n int) map[string]int {
+	counts := make(map[string]int)
+	for _, id := range strings.Split(picks(b, n), ",") {
+		counts[id]++
+	}
+	return counts
+}
+
+func TestPeakEWMAPeakReplacesAverage(t *testing.T) {
+	pe := NewPeakEWMABalancer(time.Minute)
+	srv := newWeightedServers(1)[0]
+
+	pe.Observe(srv, 5*time.Millisecond, nil)
+	pe.Observe(srv, 350*time.Millisecond, nil)
+
+	if got := time.Duration(pe.latencies.latency(srv.ID)); got < 349*time.Millisecond {
+		t.Errorf("latency after a 350ms peak = %s, want 350ms", got)
+	}
+
+	// Lower samples are averaged in.
+	pe.Observe(srv, 5*time.Millisecond, nil)
+	if got := time.Duration(pe.latencies.latency(srv.ID)); got < 340*time.Millisecond {
+		t.Errorf("latency = %s, want it to fall slowly from 350ms", got)
+	}
+}
+
+func TestPeakEWMASpikeDecays(t *testing.T) {
+	const decay = 20 * time.Millisecond
+
+	servers := newWeightedServers(1, 1)
+	pe := NewPeakEWMABalancer(decay)
+	pe.SetServers(servers)
+
+	pe.Observe(servers[0], 350*time.Millisecond, nil)
+	pe.Observe(servers[1], 5*time.Millisecond, nil)
+
+	if counts := countPicks(pe, 100); counts["a"] != 0 {
+		t.Fatalf("a was picked %d times right after its spike", counts["a"])
+	}
+
+	// b keeps answering in 5ms, a gets no traffic: its spike decays until a
+	// is tried again.
+	deadline := time.Now().Add(20 * decay)
+	for {
+		srv := pe.SelectServer(&SelectContext{})
+		if srv == servers[0] {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("a was not picked again within 20 decay windows, its latency is %s", time.Duration(pe.latencies.latency("a")))
+		}
+
+		pe.Observe(srv, 5*time.Millisecond, nil)
+		time.Sleep(time.Millisecond)
+	}
+
+	if got := time.Duration(pe.latencies.latency("a")); got > 5*time.Millisecond {
+		t.Errorf("latency of a = %s when it was picked again, want below 5ms", got)
+	}
+}
+
+func TestPeakEWMAStaleLatencyDecays(t *testing.T) {
+	const decay = 20 * time.Millisecond
+
+	pe := NewPeakEWMABalancer(decay)
+	srv := newWeightedServers(1)[0]
+
+	pe.Observe(srv, time.Millisecond, errors.New("connection refused"))
+	if got := time.Duration(pe.latencies.latency(srv.ID)); got < failurePenalty*99/100 {
+		t.Fatalf("latency of a failed request = %s, want %s", got, failurePenalty)
+	}
+
+	// Ten decay windows leave e^-10 of it.
+	time.Sleep(10 * decay)
+
+	if got := time.Duration(pe.latencies.latency(srv.ID)); got > failurePenalty/1000 {
+		t.Errorf("latency 10 decay windows after the failure = %s, want below %s", got, failurePenalty/1000)
+	}
+}
+
+func TestPeakEWMAColdStart(t *testing.T) {
+	servers := newWeightedServers(1, 1, 1)
+	pe := NewPeakEWMABalancer(time.Minute)
+	pe.SetServers(servers)
+
+	pe.Observe(servers[0], 5*time.Millisecond, nil)
+	pe.Observe(servers[1], 5*time.Millisecond, nil)
+
+	// c was never observed, but has requests in flight.
+	for range 50 {
+		servers[2].IncrementConnections()
+	}
+
+	if counts := countPicks(pe, 1000); counts["c"] != 0 {
+		t.Errorf("unobserved c with 50 requests in flight was picked %d times over idle servers", counts["c"])
+	}
+
+	if got, want := time.Duration(pe.latencies.latency("c")), 5*time.Millisecond; got != want {
+		t.Errorf("latency of unobserved c = %s, want the mean %s", got, want)
+	}
+}
+
+func TestPeakEWMANothingObserved(t *testing.T) {
+	servers := newWeightedServers(1, 1)
+	pe := NewPeakEWMABalancer(time.Minute)
+	pe.SetServers(servers)
+
+	servers[0].IncrementConnections()
+
+	// Without latencies in-flight requests decide.
+	if counts := countPicks(pe, 100); counts["b"] != 100 {
+		t.Errorf("idle b was picked %d of 100 times, want all", counts["b"])
+	}
+}
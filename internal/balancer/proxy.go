@@ -0,0 +1,219 @@
+package balancer
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+// hopHeaders only apply to a single connection and are not forwarded
+// (RFC 9110, section 7.6.1).
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// newUpstreamRequest builds the request sent to backend over scheme for the
+// client request r. body replaces r.Body, so buffered bodies can be sent again.
+func newUpstreamRequest(r *http.Request, body io.Reader, backend *server.Backend, scheme string, cfg config.Proxy) (*http.Request, error) {
+	target := url.URL{
+		Scheme:   scheme,
+		Host:     backend.URL,
+		Path:     r.URL.Path,
+		RawPath:  r.URL.RawPath,
+		RawQuery: r.URL.RawQuery,
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	// NewRequest only knows the length of buffered bodies.
+	if req.ContentLength == 0 {
+		req.ContentLength = r.ContentLength
+	}
+	if req.ContentLength == 0 {
+		req.Body = nil
+	}
+
+	req.Header = r.Header.Clone()
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+
+	// Keep "Te: trailers", backends like gRPC servers require it.
+	keepTrailers := headerHasToken(r.Header, "Te", "trailers")
+	removeHopHeaders(req.Header)
+	if keepTrailers {
+		req.Header.Set("Te", "trailers")
+	}
+
+	switch {
+	case cfg.PreserveHost:
+		req.Host = r.Host
+	case cfg.Host != "":
+		req.Host = cfg.Host
+	}
+
+	setForwardedHeaders(req.Header, r)
+
+	return req, nil
+}
+
+// headerHasToken reports whether the comma separated values of header name
+// contain token, parameters are ignored.
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, field := range strings.Split(value, ",") {
+			field, _, _ = strings.Cut(field, ";")
+			if strings.EqualFold(textproto.TrimString(field), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func removeHopHeaders(h http.Header) {
+	for _, value := range h["Connection"] {
+		for _, field := range strings.Split(value, ",") {
+			if field = textproto.TrimString(field); field != "" {
+				h.Del(field)
+			}
+		}
+	}
+
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+// setForwardedHeaders adds the X-Forwarded-* headers and the RFC 7239
+// Forwarded header describing the client request r.
+func setForwardedHeaders(h http.Header, r *http.Request) {
+	ip := clientIP(r)
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+
+	if prior := h.Values("X-Forwarded-For"); len(prior) > 0 {
+		ip = strings.Join(prior, ", ") + ", " + ip
+	}
+	h.Set("X-Forwarded-For", ip)
+	h.Set("X-Forwarded-Proto", proto)
+	h.Set("X-Forwarded-Host", r.Host)
+
+	forwarded := "for=" + forwardedNode(clientIP(r)) + ";host=" + quoteForwarded(r.Host) + ";proto=" + proto
+	if prior := h.Values("Forwarded"); len(prior) > 0 {
+		forwarded = strings.Join(prior, ", ") + ", " + forwarded
+	}
+	h.Set("Forwarded", forwarded)
+}
+
+// forwardedNode formats ip as a Forwarded node, IPv6 addresses are bracketed
+// and quoted (RFC 7239, section 6).
+func forwardedNode(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		return `"[` + ip + `]"`
+	}
+	return quoteForwarded(ip)
+}
+
+// quoteForwarded quotes value unless it is a valid token.
+func quoteForwarded(value string) string {
+	const tchars = "!#$%&'*+-.^_`|~"
+
+	for _, c := range value {
+		isToken := c < 0x80 && (c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || strings.ContainsRune(tchars, c))
+		if !isToken {
+			return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+		}
+	}
+	return value
+}
+
+// writeResponse copies resp, including its trailers, to w.
+func writeResponse(w http.ResponseWriter, resp *http.Response) error {
+	removeHopHeaders(resp.Header)
+
+	header := w.Header()
+	for name, values := range resp.Header {
+		header[name] = append([]string(nil), values...)
+	}
+
+	// Announce the trailers known in advance, the ones appearing after the
+	// body are sent with http.TrailerPrefix.
+	announced := make(map[string]bool, len(resp.Trailer))
+	for name := range resp.Trailer {
+		announced[name] = true
+		header.Add("Trailer", name)
+	}
+
+	w.WriteHeader(resp.StatusCode)
+
+	var dst io.Writer = w
+	if isStreaming(resp) {
+		dst = &flushWriter{w: w, rc: http.NewResponseController(w)}
+	}
+	if _, err := io.Copy(dst, resp.Body); err != nil {
+		return err
+	}
+
+	for name, values := range resp.Trailer {
+		if !announced[name] {
+			name = http.TrailerPrefix + name
+		}
+		for _, value := range values {
+			header.Add(name, value)
+		}
+	}
+
+	return nil
+}
+
+// isStreaming reports whether resp is streamed, server-sent events or a body
+// of unknown length, and must reach the client as it comes.
+func isStreaming(resp *http.Response) bool {
+	if resp.ContentLength == -1 {
+		return true
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return mediaType == "text/event-stream"
+}
+
+// flushWriter flushes every write to the client.
+type flushWriter struct {
+	w  io.Writer
+	rc *http.ResponseController
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	if err := f.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return n, err
+	}
+
+	return n, nil
+}
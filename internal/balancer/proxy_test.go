@@ -0,0 +1,376 @@
+package balancer
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+	"github.com/dzhordano/balancer-go/internal/server"
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+// newTestProxy starts the balancer in front of one httptest backend running
+// handler. configure may change the default config.
+func newTestProxy(t *testing.T, handler http.HandlerFunc, configure func(cfg *config.Config)) (front *httptest.Server, backendAddr string) {
+	t.Helper()
+
+	backend := httptest.NewServer(handler)
+	t.Cleanup(backend.Close)
+	backendAddr = strings.TrimPrefix(backend.URL, "http://")
+
+	var cfg config.Config
+	if err := cleanenv.ReadEnv(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.BalancingAlg = roundRobinAlg
+	if configure != nil {
+		configure(&cfg)
+	}
+
+	registry := server.NewRegistry()
+	if err := registry.Add(server.NewBackend("", backendAddr, 1, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h, err := NewBalancerHandler(log, registry, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	front = httptest.NewServer(h.Routes())
+	t.Cleanup(front.Close)
+
+	return front, backendAddr
+}
+
+func TestProxyPreservesMethodPathAndQuery(t *testing.T) {
+	type seen struct{ method, uri, body string }
+	got := make(chan seen, 1)
+
+	front, _ := newTestProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- seen{method: r.Method, uri: r.RequestURI, body: string(body)}
+	}, nil)
+
+	tests := []struct {
+		method, uri, body string
+	}{
+		{method: http.MethodGet, uri: "/"},
+		{method: http.MethodGet, uri: "/api/v1/users?id=42&sort=-name"},
+		{method: http.MethodGet, uri: "/files/a%2Fb%20c?q=%26x%3D1&q=2"},
+		{method: http.MethodPost, uri: "/orders", body: `{"id":1}`},
+		{method: http.MethodPatch, uri: "/orders/1?dry_run", body: "status=paid"},
+		{method: http.MethodDelete, uri: "/orders/1"},
+		{method: "PURGE", uri: "/cache/key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.uri, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, front.URL+tt.uri, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			s := <-got
+			if s.method != tt.method || s.uri != tt.uri || s.body != tt.body {
+				t.Errorf("backend got %s %s %q, want %s %s %q", s.method, s.uri, s.body, tt.method, tt.uri, tt.body)
+			}
+		})
+	}
+}
+
+func TestNewUpstreamRequestRemovesHopHeaders(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	r.Header.Set("Connection", "keep-alive, X-Session-Secret")
+	r.Header.Add("Connection", "X-Other")
+	r.Header.Set("X-Session-Secret", "hunter2")
+	r.Header.Set("X-Other", "1")
+	r.Header.Set("Keep-Alive", "timeout=5")
+	r.Header.Set("Proxy-Connection", "keep-alive")
+	r.Header.Set("Proxy-Authorization", "Basic Zm9vOmJhcg==")
+	r.Header.Set("Transfer-Encoding", "chunked")
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("Trailer", "X-Checksum")
+	r.Header.Set("Te", "gzip")
+	r.Header.Set("Authorization", "Bearer token")
+	r.Header.Set("X-Request-Id", "abc")
+
+	req, err := newUpstreamRequest(r, nil, server.NewBackend("", "backend:8080", 1, 0), "http", config.Proxy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"Connection", "X-Session-Secret", "X-Other", "Keep-Alive", "Proxy-Connection", "Proxy-Authorization", "Transfer-Encoding", "Upgrade", "Trailer", "Te"} {
+		if v, ok := req.Header[name]; ok {
+			t.Errorf("%s = %q was forwarded", name, v)
+		}
+	}
+
+	for name, want := range map[string]string{"Authorization": "Bearer token", "X-Request-Id": "abc"} {
+		if got := req.Header.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+
+	// The client request is left untouched.
+	if r.Header.Get("X-Session-Secret") == "" {
+		t.Error("client request headers were modified")
+	}
+}
+
+func TestNewUpstreamRequestKeepsTeTrailers(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "http://example.com/grpc.Service/Method", nil)
+	r.Header.Set("Te", "gzip, trailers;q=1")
+
+	req, err := newUpstreamRequest(r, nil, server.NewBackend("", "backend:8080", 1, 0), "http", config.Proxy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := req.Header.Get("Te"); got != "trailers" {
+		t.Errorf("Te = %q, want trailers", got)
+	}
+}
+
+func TestNewUpstreamRequestForwardedHeaders(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		host       string
+		tls        bool
+		prior      http.Header
+		want       http.Header
+	}{
+		{
+			name:       "ipv4",
+			remoteAddr: "192.0.2.1:51000",
+			host:       "example.com",
+			want: http.Header{
+				"X-Forwarded-For":   {"192.0.2.1"},
+				"X-Forwarded-Proto": {"http"},
+				"X-Forwarded-Host":  {"example.com"},
+				"Forwarded":         {"for=192.0.2.1;host=example.com;proto=http"},
+			},
+		},
+		{
+			name:       "ipv6 over tls",
+			remoteAddr: "[2001:db8::1]:51000",
+			host:       "example.com:8443",
+			tls:        true,
+			want: http.Header{
+				"X-Forwarded-For":   {"2001:db8::1"},
+				"X-Forwarded-Proto": {"https"},
+				"X-Forwarded-Host":  {"example.com:8443"},
+				"Forwarded":         {`for="[2001:db8::1]";host="example.com:8443";proto=https`},
+			},
+		},
+		{
+			name:       "appends to prior proxies",
+			remoteAddr: "192.0.2.1:51000",
+			host:       "example.com",
+			prior: http.Header{
+				"X-Forwarded-For": {"203.0.113.7, 198.51.100.2"},
+				"Forwarded":       {"for=203.0.113.7", "for=198.51.100.2"},
+			},
+			want: http.Header{
+				"X-Forwarded-For":   {"203.0.113.7, 198.51.100.2, 192.0.2.1"},
+				"X-Forwarded-Proto": {"http"},
+				"X-Forwarded-Host":  {"example.com"},
+				"Forwarded":         {"for=203.0.113.7, for=198.51.100.2, for=192.0.2.1;host=example.com;proto=http"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			r.Host = tt.host
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			for name, values := range tt.prior {
+				r.Header[name] = values
+			}
+
+			req, err := newUpstreamRequest(r, nil, server.NewBackend("", "backend:8080", 1, 0), "http", config.Proxy{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for name, want := range tt.want {
+				if got := req.Header.Values(name); strings.Join(got, "|") != strings.Join(want, "|") {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestProxyHost(t *testing.T) {
+	tests := []struct {
+		name  string
+		proxy config.Proxy
+		want  string // "" means the backend address
+	}{
+		{name: "default", proxy: config.Proxy{}},
+		{name: "preserve_host", proxy: config.Proxy{PreserveHost: true}, want: "shop.example.com"},
+		{name: "host", proxy: config.Proxy{Host: "api.internal"}, want: "api.internal"},
+		{name: "preserve_host wins over host", proxy: config.Proxy{PreserveHost: true, Host: "api.internal"}, want: "shop.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(chan string, 1)
+			front, backendAddr := newTestProxy(t, func(w http.ResponseWriter, r *http.Request) {
+				got <- r.Host
+			}, func(cfg *config.Config) {
+				cfg.Proxy = tt.proxy
+			})
+
+			req, err := http.NewRequest(http.MethodGet, front.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Host = "shop.example.com"
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			want := tt.want
+			if want == "" {
+				want = backendAddr
+			}
+			if host := <-got; host != want {
+				t.Errorf("backend got Host %q, want %q", host, want)
+			}
+		})
+	}
+}
+
+func TestProxyResponseHopHeaders(t *testing.T) {
+	front, _ := newTestProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Connection", "X-Backend-Secret")
+		w.Header().Set("X-Backend-Secret", "1")
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.Header().Set("X-Version", "2")
+		io.WriteString(w, "ok")
+	}, nil)
+
+	resp, err := http.Get(front.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	for _, name := range []string{"X-Backend-Secret", "Keep-Alive"} {
+		if v, ok := resp.Header[name]; ok {
+			t.Errorf("%s = %q reached the client", name, v)
+		}
+	}
+	if got := resp.Header.Get("X-Version"); got != "2" {
+		t.Errorf("X-Version = %q, want 2", got)
+	}
+}
+
+func TestProxyTrailers(t *testing.T) {
+	front, _ := newTestProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Checksum")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, "body")
+
+		w.Header().Set("X-Checksum", "abc123")
+		w.Header().Set(http.TrailerPrefix+"X-Late", "late")
+	}, nil)
+
+	resp, err := http.Get(front.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if _, ok := resp.Trailer["X-Checksum"]; !ok {
+		t.Errorf("X-Checksum is not announced, trailers: %v", resp.Trailer)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "body" {
+		t.Errorf("body = %q, want body", body)
+	}
+
+	for name, want := range map[string]string{"X-Checksum": "abc123", "X-Late": "late"} {
+		if got := resp.Trailer.Get(name); got != want {
+			t.Errorf("trailer %s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestProxyFlushesStreams(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+	}{
+		{name: "server-sent events", contentType: "text/event-stream; charset=utf-8"},
+		{name: "unknown length", contentType: "application/x-ndjson"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			release := make(chan struct{})
+			defer close(release)
+
+			front, _ := newTestProxy(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				io.WriteString(w, "first\n")
+				w.(http.Flusher).Flush()
+
+				// The second line is held until the first one reached the client.
+				<-release
+				io.WriteString(w, "second\n")
+			}, nil)
+
+			// Headers are not sent before the first flush either.
+			lines := make(chan string, 1)
+			go func() {
+				resp, err := http.Get(front.URL)
+				if err != nil {
+					lines <- err.Error()
+					return
+				}
+				defer resp.Body.Close()
+
+				line, _ := bufio.NewReader(resp.Body).ReadString('\n')
+				lines <- line
+			}()
+
+			select {
+			case line := <-lines:
+				if line != "first\n" {
+					t.Errorf("first line = %q", line)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("first line was not flushed to the client")
+			}
+		})
+	}
+}
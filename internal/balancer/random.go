@@ -1,67 +1,39 @@
 package balancer
 
 import (
-	"math/rand"
-	"sync"
+	"math/rand/v2"
+	"sync/atomic"
 
 	"github.com/dzhordano/balancer-go/internal/server"
 )
 
 type RandomBalancer struct {
-	downServers  []server.Server
-	aliveServers []server.Server
-	mu           sync.Mutex
+	alive     atomic.Pointer[serverList]
+	slowStart *slowStart
 }
 
-func (rb *RandomBalancer) SetServers(servers []server.Server) {
-	rb.mu.Lock()
-	defer rb.mu.Unlock()
-	rb.aliveServers = servers
+func (rb *RandomBalancer) SetServers(servers []*server.Backend) {
+	rb.alive.Store(&serverList{servers: servers})
 }
 
-func (rb *RandomBalancer) SelectServer(args ...interface{}) *server.Server {
-	rb.mu.Lock()
-	defer rb.mu.Unlock()
-
-	if len(rb.aliveServers) == 0 {
+func (rb *RandomBalancer) SelectServer(ctx *SelectContext) *server.Backend {
+	alive := rb.alive.Load()
+	if alive == nil {
 		return nil
 	}
 
-	return &rb.aliveServers[rand.Intn(len(rb.aliveServers))]
-}
-
-func (rb *RandomBalancer) DownServers() []server.Server {
-	rb.mu.Lock()
-	defer rb.mu.Unlock()
-	return rb.downServers
-}
-
-func (rb *RandomBalancer) AliveServers() []server.Server {
-	rb.mu.Lock()
-	defer rb.mu.Unlock()
-	return rb.aliveServers
-}
-
-func (rb *RandomBalancer) RemoveAliveServer(index int) {
-	rb.mu.Lock()
-	defer rb.mu.Unlock()
-	rb.aliveServers = append(rb.aliveServers[:index], rb.aliveServers[index+1:]...)
-}
-
-func (rb *RandomBalancer) RemoveDownServer(index int) {
-	rb.mu.Lock()
-	defer rb.mu.Unlock()
-	rb.downServers = append(rb.downServers[:index], rb.downServers[index+1:]...)
-}
+	servers := ctx.untried(alive.servers)
+	if len(servers) == 0 {
+		return nil
+	}
 
-func (rb *RandomBalancer) AddAliveServer(server server.Server) {
-	rb.mu.Lock()
-	defer rb.mu.Unlock()
-	rb.aliveServers = append(rb.aliveServers, server)
-}
+	// Servers ramping up are picked again unless admitted, the one with the
+	// biggest share always is.
+	admit := rb.slowStart.admitter(servers)
+	srv := servers[rand.IntN(len(servers))]
+	for !admit(srv) {
+		srv = servers[rand.IntN(len(servers))]
+	}
 
-func (rb *RandomBalancer) AddDownServer(server server.Server) {
-	rb.mu.Lock()
-	defer rb.mu.Unlock()
-	rb.downServers = append(rb.downServers, server)
+	return srv
 }
@@ -0,0 +1,89 @@
+package balancer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+)
+
+// Factory creates a balancer from the balancing_options config section.
+type Factory func(opts Options) (Balancer, error)
+
+// Options are passed to a Factory. Built-in algorithms read their typed
+// sections directly, algorithms registered elsewhere use Decode.
+type Options struct {
+	config.BalancingOptions
+	name string
+}
+
+// Decode decodes the balancing_options.<algorithm> section into v. Fields of
+// v are left untouched if the section is missing.
+func (o Options) Decode(v any) error {
+	node, ok := o.Custom[o.name]
+	if !ok {
+		return nil
+	}
+
+	if err := node.Decode(v); err != nil {
+		return fmt.Errorf("decoding balancing_options.%s: %w", o.name, err)
+	}
+
+	return nil
+}
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes a balancing algorithm available by name. It panics if the
+// name is registered twice or factory is nil.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if factory == nil {
+		panic("balancer: Register factory is nil for " + name)
+	}
+
+	if _, dup := factories[name]; dup {
+		panic("balancer: Register called twice for " + name)
+	}
+
+	factories[name] = factory
+}
+
+// Algorithms returns the sorted names of the registered algorithms.
+func Algorithms() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// New creates the balancer registered under name.
+func New(name string, opts config.BalancingOptions) (Balancer, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[name]
+	factoriesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown balancing algorithm %q (registered: %s)", name, strings.Join(Algorithms(), ", "))
+	}
+
+	balancer, err := factory(Options{BalancingOptions: opts, name: name})
+	if err != nil {
+		return nil, fmt.Errorf("creating %s balancer: %w", name, err)
+	}
+
+	return balancer, nil
+}
@@ -0,0 +1,103 @@
+package balancer
+
+import (
+	"hash/fnv"
+	"math"
+	"sort"
+	"sync/atomic"
+
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+// RendezvousHashBalancer implements highest-random-weight hashing: every alive
+// server is scored against the key and the highest score wins. Weights are
+// applied with the logarithmic method, so a server's share of keys is
+// proportional to its weight.
+type RendezvousHashBalancer struct {
+	alive atomic.Pointer[serverList]
+}
+
+func (rh *RendezvousHashBalancer) SetServers(servers []*server.Backend) {
+	rh.alive.Store(&serverList{servers: servers})
+}
+
+// SelectServer returns the untried backend with the highest score, so a
+// retry goes to the next owner of the key in TopK order.
+func (rh *RendezvousHashBalancer) SelectServer(ctx *SelectContext) *server.Backend {
+	alive := rh.alive.Load()
+	if alive == nil {
+		return nil
+	}
+
+	var best *server.Backend
+	bestScore := math.Inf(-1)
+	for _, srv := range alive.servers {
+		if ctx.WasTried(srv) {
+			continue
+		}
+
+		if score := rendezvousScore(ctx.HashKey, srv); score > bestScore {
+			best, bestScore = srv, score
+		}
+	}
+
+	return best
+}
+
+// TopK returns up to k alive servers ordered by their score for key. The
+// first one is the owner of the key, the following ones are the servers a
+// retry should go to.
+func (rh *RendezvousHashBalancer) TopK(key string, k int) []*server.Backend {
+	alive := rh.alive.Load()
+	if alive == nil {
+		return nil
+	}
+
+	type scored struct {
+		srv   *server.Backend
+		score float64
+	}
+
+	scores := make([]scored, len(alive.servers))
+	for i, srv := range alive.servers {
+		scores[i] = scored{srv: srv, score: rendezvousScore(key, srv)}
+	}
+
+	sort.Slice(scores, func(a, b int) bool {
+		return scores[a].score > scores[b].score
+	})
+
+	if k > len(scores) {
+		k = len(scores)
+	}
+
+	top := make([]*server.Backend, 0, k)
+	for _, s := range scores[:k] {
+		top = append(top, s.srv)
+	}
+
+	return top
+}
+
+// rendezvousScore computes -weight/ln(h) where h is the hash of the
+// (server, key) pair mapped to (0, 1).
+func rendezvousScore(key string, srv *server.Backend) float64 {
+	h := fnv.New64a()
+	h.Write([]byte(srv.ID))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+
+	u := (float64(mix64(h.Sum64())>>11) + 0.5) / (1 << 53)
+
+	return -float64(serverWeight(srv)) / math.Log(u)
+}
+
+// mix64 is the splitmix64 finalizer, fnv alone distributes short keys poorly.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,76 @@
+package balancer
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+func TestRendezvousHashWeightedShares(t *testing.T) {
+	servers := newWeightedServers(1, 2, 3, 4)
+	rh := &RendezvousHashBalancer{}
+	rh.SetServers(servers)
+
+	counts := make(map[*server.Backend]int)
+	for i := range ringKeys {
+		counts[rh.SelectServer(&SelectContext{HashKey: fmt.Sprintf("key-%d", i)})]++
+	}
+
+	// Shares of keys are proportional to the weights: 10%, 20%, 30%, 40%.
+	for _, srv := range servers {
+		share := float64(counts[srv]) / ringKeys
+		if want := float64(srv.Weight) / 10; math.Abs(share-want) > want*0.05 {
+			t.Errorf("%s with weight %d owns %.1f%% of keys, want %.1f%%", srv.ID, srv.Weight, share*100, want*100)
+		}
+	}
+}
+
+func TestRendezvousHashRetriesFollowTopK(t *testing.T) {
+	servers := newRingServers(5)
+	rh := &RendezvousHashBalancer{}
+	rh.SetServers(servers)
+
+	for i := range 200 {
+		key := fmt.Sprintf("key-%d", i)
+		top := rh.TopK(key, len(servers))
+
+		ctx := &SelectContext{HashKey: key}
+		for attempt, want := range top {
+			srv := rh.SelectServer(ctx)
+			if srv != want {
+				t.Fatalf("%s attempt %d went to %s, want %s, number %d of TopK", key, attempt, srv.ID, want.ID, attempt+1)
+			}
+			ctx.Tried = append(ctx.Tried, srv)
+		}
+
+		if srv := rh.SelectServer(ctx); srv != nil {
+			t.Fatalf("%s went to %s with every server tried", key, srv.ID)
+		}
+	}
+}
+
+func TestRendezvousHashTopK(t *testing.T) {
+	rh := &RendezvousHashBalancer{}
+	if top := rh.TopK("key", 2); top != nil {
+		t.Errorf("TopK without servers = %v, want nil", top)
+	}
+
+	servers := newRingServers(3)
+	rh.SetServers(servers)
+
+	all := rh.TopK("key", 10)
+	if len(all) != len(servers) {
+		t.Fatalf("TopK(10) returned %d servers, want all %d", len(all), len(servers))
+	}
+
+	// The first servers of a bigger k are the same.
+	top := rh.TopK("key", 2)
+	if len(top) != 2 || top[0] != all[0] || top[1] != all[1] {
+		t.Errorf("TopK(2) is not the start of TopK(10)")
+	}
+	if owner := rh.SelectServer(&SelectContext{HashKey: "key"}); owner != top[0] {
+		t.Errorf("key is owned by %s, want the first of TopK %s", owner.ID, top[0].ID)
+	}
+}
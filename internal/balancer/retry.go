@@ -0,0 +1,143 @@
+package balancer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+)
+
+const (
+	retryOnConnectError = "connect_error"
+	retryOnTimeout      = "timeout"
+)
+
+// retryPolicy decides which failed requests are sent again to another
+// backend.
+type retryPolicy struct {
+	attempts    int // retries after the first try
+	onConnect   bool
+	onTimeout   bool
+	statuses    map[int]bool
+	allMethods  bool
+	maxBodySize int64
+	budget      *retryBudget
+}
+
+func newRetryPolicy(cfg config.Retry) (*retryPolicy, error) {
+	p := &retryPolicy{
+		attempts:    cfg.Attempts,
+		statuses:    make(map[int]bool),
+		allMethods:  cfg.AllMethods,
+		maxBodySize: cfg.MaxBodySize,
+		budget: &retryBudget{
+			percent:    cfg.Budget.Percent,
+			minRetries: int64(cfg.Budget.MinRetries),
+		},
+	}
+
+	for _, cond := range cfg.On {
+		switch cond {
+		case retryOnConnectError:
+			p.onConnect = true
+		case retryOnTimeout:
+			p.onTimeout = true
+		default:
+			status, err := strconv.Atoi(cond)
+			if err != nil || status < 500 || status > 599 {
+				return nil, fmt.Errorf("unknown retry condition %q (want %s, %s or a 5xx status code)", cond, retryOnConnectError, retryOnTimeout)
+			}
+			p.statuses[status] = true
+		}
+	}
+
+	return p, nil
+}
+
+// allows reports whether r may be retried at all.
+func (p *retryPolicy) allows(r *http.Request) bool {
+	return p.attempts > 0 && (p.allMethods || isIdempotent(r.Method))
+}
+
+// shouldRetry reports whether the outcome of an attempt is a retry condition.
+func (p *retryPolicy) shouldRetry(resp *http.Response, err error) bool {
+	if err == nil {
+		return p.statuses[resp.StatusCode]
+	}
+
+	var netErr net.Error
+	if p.onTimeout && (errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout()) {
+		return true
+	}
+
+	var opErr *net.OpError
+	return p.onConnect && errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// retryBudget limits concurrent retries across all backends to a percentage
+// of the active requests, so retries can not amplify an outage.
+type retryBudget struct {
+	percent    float64
+	minRetries int64 // retries allowed regardless of the number of active requests
+	active     atomic.Int64
+	retries    atomic.Int64
+}
+
+func (b *retryBudget) tryAcquire() bool {
+	limit := max(b.minRetries, int64(float64(b.active.Load())*b.percent/100))
+
+	for {
+		retries := b.retries.Load()
+		if retries >= limit {
+			return false
+		}
+
+		if b.retries.CompareAndSwap(retries, retries+1) {
+			return true
+		}
+	}
+}
+
+func (b *retryBudget) release() {
+	b.retries.Add(-1)
+}
+
+// bufferBody reads the body of r so it can be sent more than once. If it is
+// bigger than limit, the part read so far is put back and false is returned.
+func bufferBody(r *http.Request, limit int64) ([]byte, bool, error) {
+	if r.ContentLength > limit {
+		return nil, false, nil
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+
+	if int64(len(buf)) > limit {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+
+		return nil, false, nil
+	}
+
+	return buf, true, nil
+}
@@ -0,0 +1,260 @@
+package balancer
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+	"github.com/dzhordano/balancer-go/internal/server"
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+// testBackend is an httptest backend counting the requests it received.
+type testBackend struct {
+	*server.Backend
+	hits atomic.Int64
+}
+
+// newTestCluster proxies with round robin to one backend per handler, named
+// a, b, c and so on in the order of the handlers.
+func newTestCluster(t *testing.T, configure func(cfg *config.Config), handlers ...http.HandlerFunc) (*httptest.Server, []*testBackend) {
+	t.Helper()
+
+	var cfg config.Config
+	if err := cleanenv.ReadEnv(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.BalancingAlg = roundRobinAlg
+	if configure != nil {
+		configure(&cfg)
+	}
+
+	registry := server.NewRegistry()
+	backends := make([]*testBackend, len(handlers))
+	for i, handler := range handlers {
+		tb := &testBackend{}
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tb.hits.Add(1)
+			handler(w, r)
+		}))
+		t.Cleanup(srv.Close)
+
+		tb.Backend = server.NewBackend(string(rune('a'+i)), strings.TrimPrefix(srv.URL, "http://"), 1, 0)
+		if err := registry.Add(tb.Backend); err != nil {
+			t.Fatal(err)
+		}
+		backends[i] = tb
+	}
+
+	h, err := NewBalancerHandler(slog.New(slog.NewTextHandler(io.Discard, nil)), registry, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	front := httptest.NewServer(h.Routes())
+	t.Cleanup(func() {
+		front.Close()
+		h.Close()
+	})
+
+	return front, backends
+}
+
+func respondStatus(status int) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(status)
+	}
+}
+
+// do sends a request through front and returns the status code.
+func do(t *testing.T, front *httptest.Server, method, body string) int {
+	t.Helper()
+
+	req, err := http.NewRequest(method, front.URL+"/", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := front.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	return resp.StatusCode
+}
+
+func hits(backends []*testBackend) []int64 {
+	counts := make([]int64, len(backends))
+	for i, tb := range backends {
+		counts[i] = tb.hits.Load()
+	}
+	return counts
+}
+
+func TestRetryPicksUntriedBackend(t *testing.T) {
+	front, backends := newTestCluster(t, func(cfg *config.Config) {
+		cfg.Retry.Attempts = 2
+	}, respondStatus(http.StatusBadGateway), respondStatus(http.StatusServiceUnavailable), respondStatus(http.StatusOK))
+
+	for i := range 6 {
+		before := hits(backends)
+		if status := do(t, front, http.MethodGet, ""); status != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200", i, status)
+		}
+
+		for j, n := range hits(backends) {
+			if n-before[j] > 1 {
+				t.Fatalf("request %d was sent %d times to %s", i, n-before[j], backends[j].ID)
+			}
+		}
+	}
+}
+
+func TestRetryRefusesNonIdempotentMethods(t *testing.T) {
+	tests := []struct {
+		name       string
+		allMethods bool
+		wantHits   int64
+	}{
+		{name: "not retried", allMethods: false, wantHits: 4},
+		{name: "all methods", allMethods: true, wantHits: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			front, backends := newTestCluster(t, func(cfg *config.Config) {
+				cfg.Retry.Attempts = 1
+				cfg.Retry.AllMethods = tt.allMethods
+			}, respondStatus(http.StatusBadGateway), respondStatus(http.StatusOK))
+
+			for range 4 {
+				do(t, front, http.MethodPost, "payload")
+			}
+
+			// Every other request starts on a, only those can be retried.
+			if got := backends[0].hits.Load() + backends[1].hits.Load(); got != tt.wantHits {
+				t.Errorf("backends got %d requests, want %d", got, tt.wantHits)
+			}
+		})
+	}
+}
+
+func TestRetrySkipsBodiesAboveMaxBodySize(t *testing.T) {
+	received := make(chan string, 8)
+	echo := func(status int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			received <- string(body)
+			w.WriteHeader(status)
+		}
+	}
+
+	front, backends := newTestCluster(t, func(cfg *config.Config) {
+		cfg.Retry.Attempts = 1
+		cfg.Retry.MaxBodySize = 8
+	}, echo(http.StatusBadGateway), echo(http.StatusOK))
+
+	// The request starts on a.
+	big := strings.Repeat("x", 16)
+	if status := do(t, front, http.MethodPut, big); status != http.StatusBadGateway {
+		t.Errorf("status = %d, want 502 from the only attempt", status)
+	}
+	if got := <-received; got != big {
+		t.Errorf("backend got body %q, want %q", got, big)
+	}
+	if got := hits(backends); got[0] != 1 || got[1] != 0 {
+		t.Errorf("hits = %v, want [1 0]", got)
+	}
+
+	// The rotation moved on, skip b.
+	do(t, front, http.MethodPut, "")
+	<-received
+
+	if status := do(t, front, http.MethodPut, "small"); status != http.StatusOK {
+		t.Errorf("status = %d, want 200 from the retry", status)
+	}
+	for range 2 {
+		if got := <-received; got != "small" {
+			t.Errorf("backend got body %q, want small", got)
+		}
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	tests := []struct {
+		name       string
+		minRetries int
+		want502    int
+	}{
+		{name: "exhausted", minRetries: 0, want502: 2},
+		{name: "released after every retry", minRetries: 1, want502: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			front, _ := newTestCluster(t, func(cfg *config.Config) {
+				cfg.Retry.Attempts = 1
+				cfg.Retry.Budget.Percent = 0
+				cfg.Retry.Budget.MinRetries = tt.minRetries
+			}, respondStatus(http.StatusBadGateway), respondStatus(http.StatusOK))
+
+			failed := 0
+			for range 4 {
+				if do(t, front, http.MethodGet, "") == http.StatusBadGateway {
+					failed++
+				}
+			}
+
+			if failed != tt.want502 {
+				t.Errorf("%d requests failed, want %d", failed, tt.want502)
+			}
+		})
+	}
+}
+
+func TestRetryKeepsRoundRobinRotation(t *testing.T) {
+	front, backends := newTestCluster(t, func(cfg *config.Config) {
+		cfg.Retry.Attempts = 1
+	}, respondStatus(http.StatusBadGateway), respondStatus(http.StatusOK))
+
+	for range 4 {
+		if status := do(t, front, http.MethodGet, ""); status != http.StatusOK {
+			t.Fatalf("status = %d, want 200", status)
+		}
+	}
+
+	// a fails the requests that start on it, half of them.
+	if got := hits(backends); got[0] != 2 || got[1] != 4 {
+		t.Errorf("hits = %v, want [2 4]", got)
+	}
+}
+
+func TestHedgeKeepsRoundRobinRotation(t *testing.T) {
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+	}
+
+	front, backends := newTestCluster(t, func(cfg *config.Config) {
+		cfg.Hedging.Routes = []config.HedgeRoute{{Path: "/", Delay: 10 * time.Millisecond}}
+	}, slow, respondStatus(http.StatusOK))
+
+	for range 4 {
+		do(t, front, http.MethodGet, "")
+	}
+
+	// Only the requests that start on a are hedged to b.
+	if got := hits(backends); got[0] != 2 || got[1] != 4 {
+		t.Errorf("hits = %v, want [2 4]", got)
+	}
+}
@@ -1,75 +1,44 @@
 package balancer
 
 import (
-	"sync"
+	"sync/atomic"
 
 	"github.com/dzhordano/balancer-go/internal/server"
 )
 
 type RoundRobinBalancer struct {
-	downServers  []server.Server
-	aliveServers []server.Server
-	index        int
-	mu           sync.Mutex
+	alive     atomic.Pointer[serverList]
+	next      atomic.Uint64
+	slowStart *slowStart
 }
 
-func (rr *RoundRobinBalancer) SetServers(servers []server.Server) {
-	rr.aliveServers = servers
-	rr.index = 0
+func (rr *RoundRobinBalancer) SetServers(servers []*server.Backend) {
+	rr.alive.Store(&serverList{servers: servers})
 }
 
-func (rr *RoundRobinBalancer) SelectServer(args ...interface{}) *server.Server {
-	rr.mu.Lock()
-	defer rr.mu.Unlock()
-
-	if len(rr.aliveServers) == 0 {
+func (rr *RoundRobinBalancer) SelectServer(ctx *SelectContext) *server.Backend {
+	alive := rr.alive.Load()
+	if alive == nil {
 		return nil
 	}
 
-	server := &rr.aliveServers[rr.index]
-	rr.index = (rr.index + 1) % len(rr.aliveServers)
-
-	return server
-}
-
-func (rr *RoundRobinBalancer) DownServers() []server.Server {
-	rr.mu.Lock()
-	defer rr.mu.Unlock()
-	return rr.downServers
-}
-
-func (rr *RoundRobinBalancer) RemoveAliveServer(index int) {
-	rr.mu.Lock()
-	defer rr.mu.Unlock()
-	rr.aliveServers = append(rr.aliveServers[:index], rr.aliveServers[index+1:]...)
-	if len(rr.aliveServers) == 0 {
-		rr.index = 0
-		return
+	// Servers ramping up are skipped unless admitted, the first untried one
+	// is used if none is.
+	admit := rr.slowStart.admitter(alive.servers)
+	var fallback *server.Backend
+	for range alive.servers {
+		srv := alive.servers[ctx.advance(&rr.next)%uint64(len(alive.servers))]
+		if ctx.WasTried(srv) {
+			continue
+		}
+
+		if admit(srv) {
+			return srv
+		}
+		if fallback == nil {
+			fallback = srv
+		}
 	}
 
-	rr.index = (rr.index) % len(rr.aliveServers)
-}
-
-func (rr *RoundRobinBalancer) RemoveDownServer(index int) {
-	rr.mu.Lock()
-	defer rr.mu.Unlock()
-	rr.downServers = append(rr.downServers[:index], rr.downServers[index+1:]...)
-}
-
-func (rr *RoundRobinBalancer) AddAliveServer(server server.Server) {
-	rr.mu.Lock()
-	defer rr.mu.Unlock()
-	rr.aliveServers = append(rr.aliveServers, server)
-}
-
-func (rr *RoundRobinBalancer) AddDownServer(server server.Server) {
-	rr.mu.Lock()
-	defer rr.mu.Unlock()
-	rr.downServers = append(rr.downServers, server)
-}
-
-func (rr *RoundRobinBalancer) AliveServers() []server.Server {
-	rr.mu.Lock()
-	defer rr.mu.Unlock()
-	return rr.aliveServers
+	return fallback
 }
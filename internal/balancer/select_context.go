@@ -0,0 +1,59 @@
+package balancer
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+// SelectContext describes the request a backend is selected for.
+type SelectContext struct {
+	Request  *http.Request
+	ClientIP string            // address of the client without the port
+	HashKey  string            // key built from the hash_key config section
+	Attempt  int               // 0 for the first try, incremented on every retry
+	Tried    []*server.Backend // backends that already failed this request or were rejected by their circuit breaker
+
+	cursor uint64 // position of the last pick of the counter based algorithms
+}
+
+// WasTried reports whether b was already tried for this request. Algorithms
+// should not return tried backends.
+func (c *SelectContext) WasTried(b *server.Backend) bool {
+	for _, tried := range c.Tried {
+		if tried == b {
+			return true
+		}
+	}
+	return false
+}
+
+// untried returns the servers that were not tried yet. servers is returned
+// as is for first attempts.
+func (c *SelectContext) untried(servers []*server.Backend) []*server.Backend {
+	if len(c.Tried) == 0 {
+		return servers
+	}
+
+	filtered := make([]*server.Backend, 0, len(servers))
+	for _, srv := range servers {
+		if !c.WasTried(srv) {
+			filtered = append(filtered, srv)
+		}
+	}
+
+	return filtered
+}
+
+// advance returns the next position of the counter based algorithms. Only
+// first attempts move the shared counter, retries and hedges continue from
+// the last pick of this request so they don't shift the rotation of others.
+func (c *SelectContext) advance(counter *atomic.Uint64) uint64 {
+	if len(c.Tried) == 0 {
+		c.cursor = counter.Add(1) - 1
+	} else {
+		c.cursor++
+	}
+	return c.cursor
+}
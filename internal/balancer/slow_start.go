@@ -0,0 +1,139 @@
+package balancer
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+const (
+	// slowStartResolution multiplies weights while some server is ramping
+	// up, so small weights can still be split into shares.
+	slowStartResolution = 10
+	// slowStartSteps is the number of times precomputed selections are
+	// rebuilt during the window.
+	slowStartSteps = 20
+)
+
+// slowStart ramps up the share of traffic of servers that were just added
+// or came back alive, from minFactor of their weight up to all of it over the
+// window. A nil slowStart gives every server its full weight.
+type slowStart struct {
+	window     time.Duration
+	aggression float64
+	minFactor  float64
+}
+
+func newSlowStart(cfg config.SlowStart) *slowStart {
+	if cfg.Window <= 0 {
+		return nil
+	}
+
+	s := &slowStart{
+		window:     cfg.Window,
+		aggression: cfg.Aggression,
+		minFactor:  cfg.MinWeightPercent / 100,
+	}
+
+	if s.aggression <= 0 {
+		s.aggression = 1
+	}
+	s.minFactor = min(max(s.minFactor, 0.01), 1)
+
+	return s
+}
+
+// factor returns the share of its weight srv gets at now, 1 once the window
+// passed.
+func (s *slowStart) factor(srv *server.Backend, now time.Time) float64 {
+	if s == nil {
+		return 1
+	}
+
+	elapsed := now.Sub(srv.AliveSince())
+	if elapsed >= s.window {
+		return 1
+	}
+
+	f := math.Pow(max(float64(elapsed), 0)/float64(s.window), 1/s.aggression)
+	return max(f, s.minFactor)
+}
+
+// admitter returns a function reporting whether a request may go to one of
+// servers, with the probability of its share relative to the biggest one.
+// The server with the biggest share is always admitted.
+func (s *slowStart) admitter(servers []*server.Backend) func(srv *server.Backend) bool {
+	if s == nil {
+		return func(*server.Backend) bool { return true }
+	}
+
+	now := time.Now()
+	top := 0.0
+	for _, srv := range servers {
+		top = max(top, s.factor(srv, now))
+	}
+
+	return func(srv *server.Backend) bool {
+		f := s.factor(srv, now) / top
+		return f >= 1 || rand.Float64() < f
+	}
+}
+
+// scale multiplies the weights of the servers by their shares and reports
+// whether some server is ramping up. Weights are left untouched otherwise.
+func (s *slowStart) scale(servers []*server.Backend, weights []int, now time.Time) bool {
+	if s == nil {
+		return false
+	}
+
+	factors := make([]float64, len(servers))
+	ramping := false
+	for i, srv := range servers {
+		factors[i] = s.factor(srv, now)
+		ramping = ramping || factors[i] < 1
+	}
+
+	if !ramping {
+		return false
+	}
+
+	for i := range weights {
+		if weights[i] > 0 {
+			weights[i] = max(1, int(math.Round(float64(weights[i]*slowStartResolution)*factors[i])))
+		}
+	}
+
+	return true
+}
+
+// step is how often precomputed selections are rebuilt while some server is
+// ramping up.
+func (s *slowStart) step() time.Duration {
+	return max(s.window/slowStartSteps, 100*time.Millisecond)
+}
+
+// lessConnections wraps less of the least connections and p2c algorithms:
+// when a or b is ramping up, in-flight requests are compared per unit of its
+// share, and of its weight too if weighted.
+func (s *slowStart) lessConnections(less func(a, b *server.Backend) bool, weighted bool) func(a, b *server.Backend) bool {
+	if s == nil {
+		return less
+	}
+
+	now := time.Now()
+	return func(a, b *server.Backend) bool {
+		fa, fb := s.factor(a, now), s.factor(b, now)
+		if fa == 1 && fb == 1 {
+			return less(a, b)
+		}
+
+		if weighted {
+			fa *= float64(serverWeight(a))
+			fb *= float64(serverWeight(b))
+		}
+		return float64(a.CurrentConnections()+1)/fa < float64(b.CurrentConnections()+1)/fb
+	}
+}
@@ -0,0 +1,268 @@
+package balancer
+
+import (
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+// slowStartAlgorithms are the algorithms that ramp up new servers.
+var slowStartAlgorithms = []string{
+	roundRobinAlg,
+	weightedRoundRobinAlg,
+	leastConnAlg,
+	weightedLeastConnAlg,
+	p2cAlg,
+	weightedP2CAlg,
+	randomAlg,
+}
+
+func TestNewSlowStart(t *testing.T) {
+	tests := []struct {
+		name           string
+		cfg            config.SlowStart
+		wantNil        bool
+		wantAggression float64
+		wantMinFactor  float64
+	}{
+		{name: "disabled", cfg: config.SlowStart{}, wantNil: true},
+		{name: "configured", cfg: config.SlowStart{Window: time.Minute, Aggression: 2, MinWeightPercent: 25}, wantAggression: 2, wantMinFactor: 0.25},
+		{name: "aggression defaults to linear", cfg: config.SlowStart{Window: time.Minute, MinWeightPercent: 10}, wantAggression: 1, wantMinFactor: 0.1},
+		{name: "min factor is at least 1%", cfg: config.SlowStart{Window: time.Minute, Aggression: 1}, wantAggression: 1, wantMinFactor: 0.01},
+		{name: "min factor is at most 100%", cfg: config.SlowStart{Window: time.Minute, Aggression: 1, MinWeightPercent: 150}, wantAggression: 1, wantMinFactor: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSlowStart(tt.cfg)
+			if tt.wantNil {
+				if s != nil {
+					t.Fatalf("slow start = %+v, want nil", s)
+				}
+				return
+			}
+
+			if s.aggression != tt.wantAggression || s.minFactor != tt.wantMinFactor {
+				t.Errorf("aggression, min factor = %v, %v, want %v, %v", s.aggression, s.minFactor, tt.wantAggression, tt.wantMinFactor)
+			}
+		})
+	}
+}
+
+func TestSlowStartFactor(t *testing.T) {
+	srv := server.NewBackend("a", "http://a", 1, 0)
+	since := srv.AliveSince()
+	window := 100 * time.Second
+
+	tests := []struct {
+		name       string
+		aggression float64
+		elapsed    time.Duration
+		want       float64
+	}{
+		{name: "starts at the min share", aggression: 1, elapsed: 0, want: 0.1},
+		{name: "linear", aggression: 1, elapsed: 25 * time.Second, want: 0.25},
+		{name: "linear half way", aggression: 1, elapsed: 50 * time.Second, want: 0.5},
+		{name: "aggressive ramps up faster", aggression: 2, elapsed: 25 * time.Second, want: 0.5},
+		{name: "gentle ramps up slower", aggression: 0.5, elapsed: 50 * time.Second, want: 0.25},
+		{name: "min share until the curve passes it", aggression: 0.5, elapsed: 25 * time.Second, want: 0.1},
+		{name: "full weight after the window", aggression: 1, elapsed: window, want: 1},
+		{name: "clock went back", aggression: 1, elapsed: -time.Second, want: 0.1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSlowStart(config.SlowStart{Window: window, Aggression: tt.aggression, MinWeightPercent: 10})
+
+			if got := s.factor(srv, since.Add(tt.elapsed)); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("factor = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	var disabled *slowStart
+	if got := disabled.factor(srv, since); got != 1 {
+		t.Errorf("factor without slow start = %v, want 1", got)
+	}
+}
+
+func TestSlowStartScale(t *testing.T) {
+	servers := newWeightedServers(2, 3, 0)
+	since := servers[0].AliveSince()
+	s := newSlowStart(config.SlowStart{Window: 100 * time.Second, Aggression: 1, MinWeightPercent: 10})
+
+	// The servers are all ramping up and at the same point of the window.
+	weights := []int{2, 3, 0}
+	if !s.scale(servers, weights, since.Add(50*time.Second)) {
+		t.Fatal("scale reported no server ramping up")
+	}
+	if want := []int{10, 15, 0}; !slices.Equal(weights, want) {
+		t.Errorf("weights = %v, want %v", weights, want)
+	}
+
+	weights = []int{2, 3, 0}
+	if !s.scale(servers, weights, since) {
+		t.Fatal("scale reported no server ramping up")
+	}
+	if want := []int{2, 3, 0}; !slices.Equal(weights, want) {
+		t.Errorf("weights at the min share = %v, want %v", weights, want)
+	}
+
+	weights = []int{2, 3, 0}
+	if s.scale(servers, weights, since.Add(100*time.Second)) {
+		t.Error("scale reported servers ramping up after the window")
+	}
+	if want := []int{2, 3, 0}; !slices.Equal(weights, want) {
+		t.Errorf("weights after the window = %v, want them untouched %v", weights, want)
+	}
+}
+
+// newRampingServers returns a server at full weight and one that was just
+// added to a registry and is ramping up.
+func newRampingServers(t *testing.T) (full, ramping *server.Backend) {
+	t.Helper()
+
+	full = server.NewBackend("a", "http://a", 1, 0)
+	ramping = server.NewBackend("b", "http://b", 1, 0)
+	if err := server.NewRegistry().Add(ramping); err != nil {
+		t.Fatal(err)
+	}
+
+	return full, ramping
+}
+
+// shareRatio selects n servers with b, holding the connection of every pick
+// until it returns, and returns the picks of ramping per pick of full.
+func shareRatio(b Balancer, full, ramping *server.Backend, n int) float64 {
+	counts := make(map[*server.Backend]int)
+	for range n {
+		srv := b.SelectServer(&SelectContext{})
+		srv.IncrementConnections()
+		counts[srv]++
+	}
+
+	for srv, count := range counts {
+		for range count {
+			srv.DecrementConnections()
+		}
+	}
+
+	return float64(counts[ramping]) / float64(counts[full])
+}
+
+func TestSlowStartShare(t *testing.T) {
+	const picks = 4000
+
+	t.Run("starts at the min share", func(t *testing.T) {
+		full, ramping := newRampingServers(t)
+
+		for _, alg := range slowStartAlgorithms {
+			b, err := New(alg, config.BalancingOptions{SlowStart: config.SlowStart{Window: time.Hour, Aggression: 1, MinWeightPercent: 20}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.SetServers([]*server.Backend{full, ramping})
+
+			if got := shareRatio(b, full, ramping, picks); math.Abs(got-0.2) > 0.05 {
+				t.Errorf("%s: ramping server got %.2f of the picks of the other, want 0.20", alg, got)
+			}
+		}
+	})
+
+	t.Run("follows the aggression curve up to full weight", func(t *testing.T) {
+		const window = time.Second
+		full, ramping := newRampingServers(t)
+
+		balancers := make(map[float64]map[string]Balancer)
+		for _, aggression := range []float64{1, 3} {
+			balancers[aggression] = make(map[string]Balancer)
+			for _, alg := range slowStartAlgorithms {
+				b, err := New(alg, config.BalancingOptions{SlowStart: config.SlowStart{Window: window, Aggression: aggression, MinWeightPercent: 1}})
+				if err != nil {
+					t.Fatal(err)
+				}
+				balancers[aggression][alg] = b
+			}
+		}
+
+		time.Sleep(window / 4)
+
+		// A quarter of the window passed: the share is about 0.25 if linear,
+		// 0.63 with an aggression of 3. It keeps growing while picking, the
+		// picks are compared with its mean.
+		for aggression, byAlg := range balancers {
+			s := newSlowStart(config.SlowStart{Window: window, Aggression: aggression, MinWeightPercent: 1})
+			for _, alg := range slowStartAlgorithms {
+				b := byAlg[alg]
+
+				before := s.factor(ramping, time.Now())
+				b.SetServers([]*server.Backend{full, ramping})
+				got := shareRatio(b, full, ramping, picks)
+				after := s.factor(ramping, time.Now())
+
+				want := (before + after) / 2
+				if math.Abs(got-want) > 0.2*want+(after-before)/2 {
+					t.Errorf("%s with aggression %v: ramping server got %.2f of the picks of the other, want %.2f", alg, aggression, got, want)
+				}
+			}
+		}
+
+		time.Sleep(window - time.Since(ramping.AliveSince()))
+
+		for _, byAlg := range balancers {
+			for _, alg := range slowStartAlgorithms {
+				b := byAlg[alg]
+				b.SetServers([]*server.Backend{full, ramping})
+				if got := shareRatio(b, full, ramping, picks); math.Abs(got-1) > 0.2 {
+					t.Errorf("%s after the window: ramping server got %.2f of the picks of the other, want 1", alg, got)
+				}
+			}
+		}
+	})
+}
+
+func TestWeightedRoundRobinSlowStartRamp(t *testing.T) {
+	full, ramping := newRampingServers(t)
+
+	wrr := &WeightedRoundRobinBalancer{slowStart: newSlowStart(config.SlowStart{Window: time.Second, Aggression: 1, MinWeightPercent: 10})}
+	wrr.SetServers([]*server.Backend{full, ramping})
+
+	// Weights are multiplied by the resolution while ramping: 10 and 1.
+	if got := len(wrr.schedule.Load().order); got != 11 {
+		t.Fatalf("cycle length = %d, want 11", got)
+	}
+
+	// The schedule is rebuilt every step without traffic, the share of b
+	// only grows.
+	share := 1.0 / 11
+	waitFor(t, func() bool {
+		order := wrr.schedule.Load().order
+		n := 0
+		for _, srv := range order {
+			if srv == ramping {
+				n++
+			}
+		}
+
+		got := float64(n) / float64(len(order))
+		if got < share {
+			t.Fatalf("b got %.2f of the cycle after %.2f", got, share)
+		}
+		share = got
+
+		return len(order) == 2
+	})
+
+	wrr.mu.Lock()
+	defer wrr.mu.Unlock()
+	if wrr.ramp != nil {
+		t.Error("ramp timer is still armed after the window")
+	}
+	if got := scheduleIDs(wrr); got != "a,b" {
+		t.Errorf("schedule = %s, want a,b", got)
+	}
+}
@@ -0,0 +1,15 @@
+package balancer
+
+import (
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+// Balancers publish the alive backends as immutable snapshots through
+// atomic.Pointer: SetServers builds a new one, SelectServer only loads it and
+// never takes a lock. Backends are pointers, so a returned backend stays
+// valid after the snapshot is replaced.
+
+// serverList is the snapshot of algorithms that need nothing but the backends.
+type serverList struct {
+	servers []*server.Backend
+}
@@ -0,0 +1,120 @@
+package balancer
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+// lockedBalancer takes a mutex around every selection, like the algorithms
+// did before they published snapshots. It is the baseline of
+// BenchmarkSelectServer.
+type lockedBalancer struct {
+	mu sync.Mutex
+	Balancer
+}
+
+func (l *lockedBalancer) SelectServer(ctx *SelectContext) *server.Backend {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.Balancer.SelectServer(ctx)
+}
+
+// BenchmarkSelectServer selects servers from 1, 8 and 64 goroutines with
+// every registered algorithm, lock-free ("snapshot") and behind a mutex
+// ("locked"). Goroutines only contend when GOMAXPROCS is above 1.
+func BenchmarkSelectServer(b *testing.B) {
+	servers := newRingServers(20)
+
+	for _, name := range Algorithms() {
+		for _, mode := range []string{"locked", "snapshot"} {
+			balancer, err := New(name, config.BalancingOptions{})
+			if err != nil {
+				b.Fatal(err)
+			}
+			if mode == "locked" {
+				balancer = &lockedBalancer{Balancer: balancer}
+			}
+			balancer.SetServers(servers)
+
+			for _, goroutines := range []int{1, 8, 64} {
+				b.Run(fmt.Sprintf("%s/%s/goroutines=%d", name, mode, goroutines), func(b *testing.B) {
+					selectConcurrently(b, balancer, goroutines)
+				})
+			}
+		}
+	}
+}
+
+// selectConcurrently splits b.N selections between goroutines.
+func selectConcurrently(b *testing.B, balancer Balancer, goroutines int) {
+	var wg sync.WaitGroup
+	for g := range goroutines {
+		n := b.N / goroutines
+		if g < b.N%goroutines {
+			n++
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx := &SelectContext{}
+			for i := range n {
+				ctx.HashKey = hashKeys[(g+i)%len(hashKeys)]
+				if srv := balancer.SelectServer(ctx); srv != nil {
+					srv.IncrementConnections()
+					srv.DecrementConnections()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// TestSnapshotSurvivesSetServers checks a selected backend stays valid and
+// the old snapshot is not modified when the servers change.
+func TestSnapshotSurvivesSetServers(t *testing.T) {
+	servers := newRingServers(3)
+
+	for _, name := range Algorithms() {
+		t.Run(name, func(t *testing.T) {
+			balancer, err := New(name, config.BalancingOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			alive := append([]*server.Backend(nil), servers...)
+			balancer.SetServers(alive)
+
+			srv := balancer.SelectServer(&SelectContext{HashKey: "key"})
+			if srv == nil {
+				t.Fatal("no server selected")
+			}
+
+			balancer.SetServers(servers[:1])
+			if srv.ID == "" || srv.URL == "" {
+				t.Fatal("selected backend was cleared")
+			}
+			for i := range alive {
+				if alive[i] != servers[i] {
+					t.Fatal("SetServers modified the previous slice")
+				}
+			}
+
+			for range 10 {
+				if got := balancer.SelectServer(&SelectContext{HashKey: "key"}); got != servers[0] {
+					t.Fatalf("selected %v from the new snapshot, want %s", got, servers[0].ID)
+				}
+			}
+
+			balancer.SetServers(nil)
+			if got := balancer.SelectServer(&SelectContext{HashKey: "key"}); got != nil {
+				t.Fatalf("selected %s with no servers", got.ID)
+			}
+		})
+	}
+}
@@ -2,82 +2,201 @@ package balancer
 
 import (
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/dzhordano/balancer-go/internal/server"
 )
 
+const (
+	// wrrRecoveryInterval is how often lowered effective weights grow back
+	// by one.
+	wrrRecoveryInterval = time.Second
+	// wrrErrorRebuildInterval is the least time between schedule rebuilds
+	// for proxy errors.
+	wrrErrorRebuildInterval = 100 * time.Millisecond
+)
+
+// WeightedRoundRobinBalancer implements nginx's smooth weighted round robin:
+// every pick adds each server's effective weight to its current weight, the
+// server with the biggest current weight wins and is lowered by the total.
+// Picks are interleaved, weights 3,1,1 give a,b,a,c,a.
+//
+// One full cycle of picks is precomputed into a schedule whenever the alive
+// set or an effective weight changes, so selection is an atomic counter
+// increment and a slice index. While a server is in its slow start window,
+// the schedule is rebuilt every step of the window with its growing weight.
+//
+// Proxy errors lower the effective weight of a server, lowered weights are
+// published at most every wrrErrorRebuildInterval and grow back by one every
+// wrrRecoveryInterval.
 type WeightedRoundRobinBalancer struct {
-	downServers  []server.Server
-	aliveServers []server.Server
-	index        int
-	current      int // Nth request number
-	mu           sync.Mutex
+	schedule atomic.Pointer[wrrSchedule]
+	next     atomic.Uint64
+
+	mu        sync.Mutex // serializes schedule rebuilds
+	servers   []*server.Backend
+	effective map[string]int // by backend ID, lowered on proxy errors
+	slowStart *slowStart
+	ramp      *time.Timer // pending rebuild while a server is ramping up
+	recovery  *time.Timer // pending recovery step while some weight is degraded
+	lowered   *time.Timer // pending rebuild of weights lowered by errors
+	loweredAt time.Time   // last rebuild of weights lowered by errors
 }
 
-func (wrr *WeightedRoundRobinBalancer) SetServers(servers []server.Server) {
-	wrr.aliveServers = servers
-
-	wrr.index = 0
-	wrr.current = 1
+type wrrSchedule struct {
+	order    []*server.Backend
+	degraded bool // some effective weight is below the configured one
 }
 
-func (wrr *WeightedRoundRobinBalancer) SelectServer(args ...interface{}) *server.Server {
+func (wrr *WeightedRoundRobinBalancer) SetServers(servers []*server.Backend) {
 	wrr.mu.Lock()
 	defer wrr.mu.Unlock()
 
-	if len(wrr.aliveServers) == 0 {
+	// Effective weights are kept, a returning backend resumes with its own.
+	wrr.servers = servers
+	wrr.rebuild()
+}
+
+func (wrr *WeightedRoundRobinBalancer) SelectServer(ctx *SelectContext) *server.Backend {
+	schedule := wrr.schedule.Load()
+	if schedule == nil {
 		return nil
 	}
 
-	server := &wrr.aliveServers[wrr.index]
-	if wrr.current >= server.Weight {
-		wrr.index = (wrr.index + 1) % len(wrr.aliveServers)
-		wrr.current = 1
-	} else {
-		wrr.current++
+	for range schedule.order {
+		i := ctx.advance(&wrr.next) % uint64(len(schedule.order))
+		if srv := schedule.order[i]; !ctx.WasTried(srv) {
+			return srv
+		}
 	}
 
-	return server
+	return nil
 }
 
-func (wrr *WeightedRoundRobinBalancer) DownServers() []server.Server {
-	wrr.mu.Lock()
-	defer wrr.mu.Unlock()
-	return wrr.downServers
-}
+// Observe lowers the effective weight of servers that failed to respond.
+func (wrr *WeightedRoundRobinBalancer) Observe(srv *server.Backend, _ time.Duration, err error) {
+	if err == nil {
+		return
+	}
 
-func (wrr *WeightedRoundRobinBalancer) RemoveAliveServer(index int) {
 	wrr.mu.Lock()
 	defer wrr.mu.Unlock()
 
-	wrr.aliveServers = append(wrr.aliveServers[:index], wrr.aliveServers[index+1:]...)
-	if len(wrr.aliveServers) == 0 {
-		wrr.index = 0
+	effective := wrr.effectiveWeight(srv) - max(1, serverWeight(srv)/2)
+	wrr.effective[srv.ID] = max(0, effective)
+
+	// During an outage every request fails, the rebuilds are batched.
+	if wrr.lowered != nil {
+		return
+	}
+	if wait := time.Until(wrr.loweredAt.Add(wrrErrorRebuildInterval)); wait > 0 {
+		wrr.lowered = time.AfterFunc(wait, wrr.rebuildLowered)
 		return
 	}
-	wrr.index = (wrr.index) % len(wrr.aliveServers)
+
+	wrr.loweredAt = time.Now()
+	wrr.rebuild()
 }
 
-func (wrr *WeightedRoundRobinBalancer) RemoveDownServer(index int) {
+func (wrr *WeightedRoundRobinBalancer) rebuildLowered() {
 	wrr.mu.Lock()
 	defer wrr.mu.Unlock()
-	wrr.downServers = append(wrr.downServers[:index], wrr.downServers[index+1:]...)
+
+	wrr.lowered = nil
+	wrr.loweredAt = time.Now()
+	wrr.rebuild()
 }
 
-func (wrr *WeightedRoundRobinBalancer) AddAliveServer(server server.Server) {
+func (wrr *WeightedRoundRobinBalancer) recover() {
 	wrr.mu.Lock()
 	defer wrr.mu.Unlock()
-	wrr.aliveServers = append(wrr.aliveServers, server)
+
+	wrr.recovery = nil
+	for _, srv := range wrr.servers {
+		if effective := wrr.effectiveWeight(srv); effective < serverWeight(srv) {
+			wrr.effective[srv.ID] = effective + 1
+		}
+	}
+	wrr.rebuild()
 }
 
-func (wrr *WeightedRoundRobinBalancer) AddDownServer(server server.Server) {
+func (wrr *WeightedRoundRobinBalancer) rampUp() {
 	wrr.mu.Lock()
 	defer wrr.mu.Unlock()
-	wrr.downServers = append(wrr.downServers, server)
+
+	wrr.ramp = nil
+	wrr.rebuild()
 }
 
-func (wrr *WeightedRoundRobinBalancer) AliveServers() []server.Server {
-	wrr.mu.Lock()
-	defer wrr.mu.Unlock()
-	return wrr.aliveServers
+// effectiveWeight must be called with mu held.
+func (wrr *WeightedRoundRobinBalancer) effectiveWeight(srv *server.Backend) int {
+	if wrr.effective == nil {
+		wrr.effective = make(map[string]int)
+	}
+
+	effective, ok := wrr.effective[srv.ID]
+	if !ok {
+		effective = serverWeight(srv)
+		wrr.effective[srv.ID] = effective
+	}
+
+	return effective
+}
+
+// rebuild runs one cycle of smooth weighted round robin over the effective
+// weights and publishes it. Must be called with mu held.
+func (wrr *WeightedRoundRobinBalancer) rebuild() {
+	schedule := &wrrSchedule{}
+
+	weights := make([]int, len(wrr.servers))
+	total := 0
+	for i, srv := range wrr.servers {
+		weights[i] = wrr.effectiveWeight(srv)
+		total += weights[i]
+
+		if weights[i] < serverWeight(srv) {
+			schedule.degraded = true
+		}
+	}
+
+	if wrr.slowStart.scale(wrr.servers, weights, time.Now()) {
+		total = 0
+		for _, w := range weights {
+			total += w
+		}
+
+		if wrr.ramp == nil {
+			wrr.ramp = time.AfterFunc(wrr.slowStart.step(), wrr.rampUp)
+		}
+	}
+
+	if schedule.degraded && wrr.recovery == nil {
+		wrr.recovery = time.AfterFunc(wrrRecoveryInterval, wrr.recover)
+	}
+
+	// Every server failed recently, fall back to plain round robin.
+	if total == 0 {
+		for i := range weights {
+			weights[i] = 1
+		}
+		total = len(weights)
+	}
+
+	current := make([]int, len(wrr.servers))
+	schedule.order = make([]*server.Backend, 0, total)
+	for range total {
+		best := 0
+		for i := range current {
+			current[i] += weights[i]
+			if current[i] > current[best] {
+				best = i
+			}
+		}
+
+		current[best] -= total
+		schedule.order = append(schedule.order, wrr.servers[best])
+	}
+
+	wrr.schedule.Store(schedule)
 }
@@ -0,0 +1,227 @@
+package balancer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+func newWeightedServers(weights ...int) []*server.Backend {
+	servers := make([]*server.Backend, len(weights))
+	for i, w := range weights {
+		id := string(rune('a' + i))
+		servers[i] = server.NewBackend(id, "http://"+id, w, 0)
+	}
+	return servers
+}
+
+// picks returns the IDs of the next n selected servers joined by commas.
+func picks(b Balancer, n int) string {
+	ids := make([]string, n)
+	for i := range ids {
+		srv := b.SelectServer(&SelectContext{})
+		if srv == nil {
+			ids[i] = "-"
+			continue
+		}
+		ids[i] = srv.ID
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestWeightedRoundRobinSequence(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []int
+		want    string
+	}{
+		{name: "3,1,1", weights: []int{3, 1, 1}, want: "a,b,a,c,a"},
+		{name: "5,1,1", weights: []int{5, 1, 1}, want: "a,a,b,a,c,a,a"},
+		{name: "2,1", weights: []int{2, 1}, want: "a,b,a"},
+		{name: "equal", weights: []int{1, 1, 1}, want: "a,b,c"},
+		{name: "unset weight counts as 1", weights: []int{0, 2}, want: "b,a,b"},
+		{name: "single", weights: []int{4}, want: "a,a,a,a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wrr := &WeightedRoundRobinBalancer{}
+			wrr.SetServers(newWeightedServers(tt.weights...))
+
+			// Two cycles, the schedule repeats.
+			n := strings.Count(tt.want, ",") + 1
+			if got := picks(wrr, 2*n); got != tt.want+","+tt.want {
+				t.Errorf("picks = %s, want %s twice", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeightedRoundRobinSkipsTried(t *testing.T) {
+	servers := newWeightedServers(3, 1, 1)
+	wrr := &WeightedRoundRobinBalancer{}
+	wrr.SetServers(servers)
+
+	ctx := &SelectContext{Tried: []*server.Backend{servers[0]}}
+	for range 5 {
+		if srv := wrr.SelectServer(ctx); srv == servers[0] {
+			t.Fatalf("selected tried server %s", srv.ID)
+		}
+	}
+
+	ctx.Tried = servers
+	if srv := wrr.SelectServer(ctx); srv != nil {
+		t.Fatalf("selected %s with every server tried", srv.ID)
+	}
+}
+
+func TestWeightedRoundRobinObserve(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []int
+		failed  []int // indexes of servers reported as failed, in order
+		want    string
+	}{
+		{name: "weight is halved", weights: []int{4, 1}, failed: []int{0}, want: "a,b,a"},
+		{name: "weight drops by at least 1", weights: []int{3, 1, 1}, failed: []int{1}, want: "a,a,c,a"},
+		{name: "weight drops to 0", weights: []int{2, 2}, failed: []int{0, 0}, want: "b,b"},
+		{name: "all failed falls back to round robin", weights: []int{1, 1}, failed: []int{0, 1}, want: "a,b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			servers := newWeightedServers(tt.weights...)
+			wrr := &WeightedRoundRobinBalancer{}
+			wrr.SetServers(servers)
+
+			for _, i := range tt.failed {
+				wrr.Observe(servers[i], time.Millisecond, errors.New("connection refused"))
+			}
+
+			// Errors after the first are published in a batch.
+			waitFor(t, func() bool { return scheduleIDs(wrr) == tt.want })
+		})
+	}
+}
+
+func TestWeightedRoundRobinObserveIgnoresSuccess(t *testing.T) {
+	servers := newWeightedServers(3, 1, 1)
+	wrr := &WeightedRoundRobinBalancer{}
+	wrr.SetServers(servers)
+
+	wrr.Observe(servers[0], time.Millisecond, nil)
+
+	if got := picks(wrr, 5); got != "a,b,a,c,a" {
+		t.Errorf("picks = %s, want a,b,a,c,a", got)
+	}
+}
+
+func TestWeightedRoundRobinBatchesErrorRebuilds(t *testing.T) {
+	servers := newWeightedServers(8, 1)
+	wrr := &WeightedRoundRobinBalancer{}
+	wrr.SetServers(servers)
+
+	// The first error is published at once: 8 -> 4.
+	wrr.Observe(servers[0], time.Millisecond, errors.New("connection refused"))
+	first := wrr.schedule.Load()
+	if got := len(first.order); got != 5 {
+		t.Fatalf("cycle length = %d, want 5", got)
+	}
+
+	// The next ones within the interval are not: 4 -> 0.
+	for range 4 {
+		wrr.Observe(servers[0], time.Millisecond, errors.New("connection refused"))
+	}
+	if wrr.schedule.Load() != first {
+		t.Fatal("schedule was rebuilt for every error")
+	}
+
+	waitFor(t, func() bool { return scheduleIDs(wrr) == "b" })
+}
+
+func TestWeightedRoundRobinRecoversOverTime(t *testing.T) {
+	servers := newWeightedServers(1, 1)
+	wrr := &WeightedRoundRobinBalancer{}
+	wrr.SetServers(servers)
+
+	wrr.Observe(servers[0], time.Millisecond, errors.New("connection refused"))
+	failed := time.Now()
+
+	// Traffic does not bring the weight back.
+	if got := picks(wrr, 10); strings.Contains(got, "a") {
+		t.Fatalf("picks = %s, a came back after a few requests", got)
+	}
+
+	waitFor(t, func() bool {
+		wrr.mu.Lock()
+		defer wrr.mu.Unlock()
+		return wrr.effective["a"] == 1
+	})
+
+	if elapsed := time.Since(failed); elapsed < wrrRecoveryInterval*9/10 {
+		t.Errorf("a recovered after %s, want %s", elapsed, wrrRecoveryInterval)
+	}
+	if wrr.schedule.Load().degraded {
+		t.Error("schedule is still degraded after full recovery")
+	}
+	if got := scheduleIDs(wrr); got != "a,b" {
+		t.Errorf("schedule = %s, want a,b", got)
+	}
+}
+
+func TestWeightedRoundRobinRecoversStepByStep(t *testing.T) {
+	servers := newWeightedServers(4, 1)
+	wrr := &WeightedRoundRobinBalancer{}
+	wrr.SetServers(servers)
+
+	// 4 -> 2, then back by one every interval: 3, then 4.
+	wrr.Observe(servers[0], time.Millisecond, errors.New("connection refused"))
+
+	for _, want := range []string{"a,b,a", "a,a,b,a", "a,a,b,a,a"} {
+		waitFor(t, func() bool { return scheduleIDs(wrr) == want })
+	}
+
+	if wrr.schedule.Load().degraded {
+		t.Error("schedule is still degraded after full recovery")
+	}
+}
+
+func TestWeightedRoundRobinKeepsEffectiveWeights(t *testing.T) {
+	servers := newWeightedServers(4, 1)
+	wrr := &WeightedRoundRobinBalancer{}
+	wrr.SetServers(servers)
+
+	wrr.Observe(servers[0], time.Millisecond, errors.New("connection refused"))
+	wrr.SetServers(servers[1:])
+	wrr.SetServers(servers)
+
+	if got := len(wrr.schedule.Load().order); got != 3 {
+		t.Errorf("cycle length = %d, want 3 (effective weight kept)", got)
+	}
+}
+
+// scheduleIDs returns the IDs of one precomputed cycle joined by commas.
+func scheduleIDs(wrr *WeightedRoundRobinBalancer) string {
+	order := wrr.schedule.Load().order
+	ids := make([]string, len(order))
+	for i, srv := range order {
+		ids[i] = srv.ID
+	}
+	return strings.Join(ids, ",")
+}
+
+// waitFor polls cond until it holds or 3 seconds passed.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
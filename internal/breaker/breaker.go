@@ -0,0 +1,247 @@
+package breaker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+)
+
+// buckets is the number of slices the error rate window is split into.
+const buckets = 10
+
+const (
+	defaultConsecutiveFailures = 5
+	defaultErrorRate           = 50
+)
+
+type State int32
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+type bucket struct {
+	start    int64 // unix nanoseconds
+	total    int
+	failures int
+}
+
+// Breaker is the circuit breaker of one backend. It opens after too many
+// consecutive failures or a too high error rate in the rolling window, lets
+// trial requests through once the open timeout passed and closes again after
+// enough of them succeeded.
+//
+// A nil Breaker lets every request through.
+type Breaker struct {
+	cfg                 config.CircuitBreaker
+	consecutiveFailures int     // 0 disables the check
+	errorRate           float64 // 0 disables the check
+	onChange            func(from, to State)
+
+	mu       sync.Mutex
+	state    State
+	failures int // consecutive failures
+	window   [buckets]bucket
+	trials   int // trial requests in flight while half-open
+	passed   int // successful trial requests while half-open
+}
+
+func newBreaker(cfg config.CircuitBreaker, onChange func(from, to State)) *Breaker {
+	if cfg.Window <= 0 {
+		cfg.Window = 10 * time.Second
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = 30 * time.Second
+	}
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = 1
+	}
+
+	b := &Breaker{
+		cfg:                 cfg,
+		consecutiveFailures: defaultConsecutiveFailures,
+		errorRate:           defaultErrorRate,
+		onChange:            onChange,
+	}
+
+	// Unset thresholds get their default, an explicit 0 disables them.
+	if cfg.ConsecutiveFailures != nil {
+		b.consecutiveFailures = *cfg.ConsecutiveFailures
+	}
+	if cfg.ErrorRate != nil {
+		b.errorRate = *cfg.ErrorRate
+	}
+
+	return b
+}
+
+func (b *Breaker) State() State {
+	if b == nil {
+		return Closed
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// Allow reports whether a request may be sent to the backend. Every allowed
+// request must be followed by Record or Cancel.
+func (b *Breaker) Allow() bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Closed:
+		return true
+	case HalfOpen:
+		if b.trials+b.passed < b.cfg.HalfOpenRequests {
+			b.trials++
+			return true
+		}
+	}
+
+	return false
+}
+
+// Record reports the outcome of an allowed request.
+func (b *Breaker) Record(success bool) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Closed:
+		b.count(success, time.Now())
+		if b.tripped() {
+			b.setState(Open)
+		}
+	case HalfOpen:
+		b.releaseTrial()
+		if !success {
+			b.setState(Open)
+			return
+		}
+
+		b.passed++
+		if b.passed >= b.cfg.HalfOpenRequests {
+			b.setState(Closed)
+		}
+	}
+}
+
+// Cancel releases an allowed request without an outcome, e.g. when the client
+// went away.
+func (b *Breaker) Cancel() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == HalfOpen {
+		b.releaseTrial()
+	}
+}
+
+// releaseTrial guards against requests allowed before the breaker opened that
+// finish while it is half-open.
+func (b *Breaker) releaseTrial() {
+	if b.trials > 0 {
+		b.trials--
+	}
+}
+
+func (b *Breaker) count(success bool, now time.Time) {
+	if success {
+		b.failures = 0
+	} else {
+		b.failures++
+	}
+
+	width := int64(b.cfg.Window) / buckets
+	start := now.UnixNano() / width * width
+
+	bk := &b.window[start/width%buckets]
+	if bk.start != start {
+		*bk = bucket{start: start}
+	}
+
+	bk.total++
+	if !success {
+		bk.failures++
+	}
+}
+
+func (b *Breaker) tripped() bool {
+	if b.consecutiveFailures > 0 && b.failures >= b.consecutiveFailures {
+		return true
+	}
+
+	if b.errorRate <= 0 {
+		return false
+	}
+
+	since := time.Now().Add(-b.cfg.Window).UnixNano()
+
+	var total, failures int
+	for _, bk := range b.window {
+		if bk.start > since {
+			total += bk.total
+			failures += bk.failures
+		}
+	}
+
+	return total >= b.cfg.MinRequests && total > 0 && float64(failures)*100 >= b.errorRate*float64(total)
+}
+
+func (b *Breaker) setState(state State) {
+	from := b.state
+	b.state = state
+	b.failures, b.trials, b.passed = 0, 0, 0
+
+	switch state {
+	case Closed:
+		b.window = [buckets]bucket{}
+	case Open:
+		time.AfterFunc(b.cfg.OpenTimeout, b.halfOpen)
+	}
+
+	if b.onChange != nil {
+		b.onChange(from, state)
+	}
+}
+
+func (b *Breaker) halfOpen() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open {
+		b.setState(HalfOpen)
+	}
+}
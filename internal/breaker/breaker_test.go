@@ -0,0 +1,156 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// fail records n failed requests.
+func fail(b *Breaker, n int) {
+	for range n {
+		b.Allow()
+		b.Record(false)
+	}
+}
+
+func TestBreakerThresholds(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.CircuitBreaker
+		failures int
+		want     State
+	}{
+		{name: "default consecutive failures", cfg: config.CircuitBreaker{MinRequests: 100}, failures: 5, want: Open},
+		{name: "below default consecutive failures", cfg: config.CircuitBreaker{MinRequests: 100}, failures: 4, want: Closed},
+		{name: "consecutive failures", cfg: config.CircuitBreaker{ConsecutiveFailures: ptr(2), MinRequests: 100}, failures: 2, want: Open},
+		{
+			name:     "consecutive failures disabled",
+			cfg:      config.CircuitBreaker{ConsecutiveFailures: ptr(0), MinRequests: 100},
+			failures: 50,
+			want:     Closed,
+		},
+		{
+			name:     "default error rate",
+			cfg:      config.CircuitBreaker{ConsecutiveFailures: ptr(0), MinRequests: 10},
+			failures: 10,
+			want:     Open,
+		},
+		{
+			name:     "both disabled",
+			cfg:      config.CircuitBreaker{ConsecutiveFailures: ptr(0), ErrorRate: ptr(0.0), MinRequests: 1},
+			failures: 100,
+			want:     Closed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.OpenTimeout = time.Hour
+			b := newBreaker(tt.cfg, nil)
+
+			fail(b, tt.failures)
+
+			if got := b.State(); got != tt.want {
+				t.Errorf("state = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreakerErrorRate(t *testing.T) {
+	b := newBreaker(config.CircuitBreaker{
+		ConsecutiveFailures: ptr(0),
+		ErrorRate:           ptr(50.0),
+		MinRequests:         10,
+		OpenTimeout:         time.Hour,
+	}, nil)
+
+	// 4 of 9 failed: below the minimum number of requests.
+	for i := range 9 {
+		b.Allow()
+		b.Record(i%2 == 0)
+	}
+	if got := b.State(); got != Closed {
+		t.Fatalf("state = %s after 9 requests, want closed", got)
+	}
+
+	// 5 of 10 failed: 50%.
+	fail(b, 1)
+	if got := b.State(); got != Open {
+		t.Fatalf("state = %s at 50%% errors, want open", got)
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	var transitions []State
+	b := newBreaker(config.CircuitBreaker{
+		ConsecutiveFailures: ptr(1),
+		OpenTimeout:         10 * time.Millisecond,
+		HalfOpenRequests:    2,
+	}, func(_, to State) { transitions = append(transitions, to) })
+
+	fail(b, 1)
+	if b.Allow() {
+		t.Fatal("open breaker allowed a request")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if got := b.State(); got != HalfOpen {
+		t.Fatalf("state = %s after the open timeout, want half-open", got)
+	}
+
+	// Only half_open_requests trials at a time.
+	if !b.Allow() || !b.Allow() {
+		t.Fatal("half-open breaker rejected a trial request")
+	}
+	if b.Allow() {
+		t.Fatal("half-open breaker allowed more trials than configured")
+	}
+
+	b.Record(true)
+	b.Record(true)
+	if got := b.State(); got != Closed {
+		t.Fatalf("state = %s after successful trials, want closed", got)
+	}
+
+	want := []State{Open, HalfOpen, Closed}
+	if len(transitions) != len(want) {
+		t.Fatalf("transitions = %v, want %v", transitions, want)
+	}
+	for i := range want {
+		if transitions[i] != want[i] {
+			t.Fatalf("transitions = %v, want %v", transitions, want)
+		}
+	}
+}
+
+func TestBreakerHalfOpenFailureReopens(t *testing.T) {
+	b := newBreaker(config.CircuitBreaker{ConsecutiveFailures: ptr(1), OpenTimeout: 10 * time.Millisecond}, nil)
+
+	fail(b, 1)
+	time.Sleep(50 * time.Millisecond)
+
+	fail(b, 1)
+	if got := b.State(); got != Open {
+		t.Fatalf("state = %s after a failed trial, want open", got)
+	}
+}
+
+func TestNilBreaker(t *testing.T) {
+	var b *Breaker
+
+	if !b.Allow() {
+		t.Error("nil breaker rejected a request")
+	}
+	b.Record(false)
+	b.Cancel()
+	if got := b.State(); got != Closed {
+		t.Errorf("state = %s, want closed", got)
+	}
+}
@@ -0,0 +1,78 @@
+package breaker
+
+import (
+	"log/slog"
+	"sync"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+	"github.com/dzhordano/balancer-go/internal/server"
+	"github.com/dzhordano/balancer-go/pkg/metrics"
+)
+
+// exclusionReason is the reason open breakers exclude their backend from the
+// registry with.
+const exclusionReason = "circuit_breaker"
+
+// Group holds the breakers of all backends. Backends with an open breaker
+// are excluded from selection until the breaker turns half-open. Transitions
+// are applied in the background, breakers trip on the request path.
+type Group struct {
+	log         *slog.Logger
+	registry    *server.Registry
+	cfg         config.CircuitBreaker
+	transitions server.Queue
+
+	mu       sync.Mutex
+	breakers map[string]*Breaker // by backend ID
+}
+
+// NewGroup returns nil when circuit breaking is disabled, a nil Group hands
+// out nil breakers.
+func NewGroup(log *slog.Logger, registry *server.Registry, cfg config.CircuitBreaker) *Group {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	return &Group{
+		log:      log,
+		registry: registry,
+		cfg:      cfg,
+		breakers: make(map[string]*Breaker),
+	}
+}
+
+// Get returns the breaker of backend, creating it on first use.
+func (g *Group) Get(backend *server.Backend) *Breaker {
+	if g == nil {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	b, ok := g.breakers[backend.ID]
+	if !ok {
+		b = newBreaker(g.cfg, func(from, to State) {
+			g.transitions.Add(func() { g.transition(backend, from, to) })
+		})
+		g.breakers[backend.ID] = b
+	}
+
+	return b
+}
+
+func (g *Group) transition(backend *server.Backend, from, to State) {
+	g.log.Info("CIRCUITBREAKER: state changed", slog.String("server", backend.URL), slog.String("from", from.String()), slog.String("to", to.String()))
+	metrics.BreakerTransition(backend.ID, from.String(), to.String(), int(to))
+
+	var err error
+	if to == Open {
+		_, err = g.registry.Exclude(backend.ID, exclusionReason)
+	} else {
+		_, err = g.registry.Include(backend.ID, exclusionReason)
+	}
+
+	if err != nil {
+		g.log.Error("CIRCUITBREAKER: failed to update server", slog.String("server", backend.URL), slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,64 @@
+package breaker
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+// TestGroupTransitionsOffRequestPath trips a breaker while a registry
+// listener, like a balancer rebuilding its table, is slow.
+func TestGroupTransitionsOffRequestPath(t *testing.T) {
+	registry := server.NewRegistry()
+	backend := server.NewBackend("", "backend:8080", 1, 0)
+	if err := registry.Add(backend); err != nil {
+		t.Fatal(err)
+	}
+
+	release := make(chan struct{})
+	excluded := make(chan struct{})
+	registry.Subscribe(func(selectable []*server.Backend) {
+		if len(selectable) == 0 {
+			<-release
+			close(excluded)
+		}
+	})
+
+	g := NewGroup(slog.New(slog.NewTextHandler(io.Discard, nil)), registry, config.CircuitBreaker{
+		Enabled:             true,
+		ConsecutiveFailures: ptr(1),
+		OpenTimeout:         time.Hour,
+	})
+	b := g.Get(backend)
+
+	recorded := make(chan struct{})
+	go func() {
+		b.Allow()
+		b.Record(false)
+		close(recorded)
+	}()
+
+	select {
+	case <-recorded:
+	case <-time.After(time.Second):
+		t.Fatal("Record waited for the registry listeners")
+	}
+
+	if b.State() != Open {
+		t.Fatalf("breaker is %s, want open", b.State())
+	}
+	if b.Allow() {
+		t.Error("open breaker let a request through before the exclusion was applied")
+	}
+
+	close(release)
+	select {
+	case <-excluded:
+	case <-time.After(time.Second):
+		t.Fatal("backend was not excluded")
+	}
+}
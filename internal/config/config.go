@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
+	"gopkg.in/yaml.v3"
 )
 
 const (
@@ -12,13 +13,24 @@ const (
 )
 
 type Config struct {
-	HTTPServer    HTTP         `yaml:"http_server"`
-	HTTPSServer   HTTPS        `yaml:"https_server"`
-	Servers       []Server     `yaml:"servers"`       // list of servers to connect to
-	BalancingAlg  string       `yaml:"balancing_alg"` // balancing algorithm to use
-	HealthCheck   Health       `yaml:"health_check"`
-	Logging       Logging      `yaml:"logging"`
-	ServersOutage ServerOutage `yaml:"servers_outage"`
+	HTTPServer    HTTP             `yaml:"http_server"`
+	HTTPSServer   HTTPS            `yaml:"https_server"`
+	AdminServer   HTTP             `yaml:"admin_server"`      // admin api, disabled when the port is empty
+	Servers       []Server         `yaml:"servers"`           // list of servers to connect to
+	BalancingAlg  string           `yaml:"balancing_alg"`     // balancing algorithm to use
+	BalancingOpts BalancingOptions `yaml:"balancing_options"` // per-algorithm settings
+	HashKey       HashKey          `yaml:"hash_key"`          // how hashing algorithms build the request key
+	Proxy         Proxy            `yaml:"proxy"`             // how requests are forwarded to the servers
+	Upstream      Upstream         `yaml:"upstream"`          // connection pool to each server
+	Retry         Retry            `yaml:"retry"`             // retries of failed requests on other servers
+	Hedging       Hedging          `yaml:"hedging"`           // duplicating slow requests to other servers
+	Breaker       CircuitBreaker   `yaml:"circuit_breaker"`   // per-server circuit breakers fed by proxied requests
+	Outlier       OutlierDetection `yaml:"outlier_detection"` // ejection of servers that answer worse than the others
+	HealthCheck   Health           `yaml:"health_check"`
+	Events        Events           `yaml:"events"` // server state changes and exclusions
+	Drain         Drain            `yaml:"drain"`  // taking servers out without dropping requests
+	Logging       Logging          `yaml:"logging"`
+	ServersOutage ServerOutage     `yaml:"servers_outage"`
 }
 
 type HTTP struct {
@@ -34,13 +46,175 @@ type HTTPS struct {
 }
 
 type Server struct {
-	URL    string `yaml:"url"`                    // url of the server
-	Weight int    `yaml:"weight" env-default:"1"` // weight of the server
+	ID           string      `yaml:"id"`                              // stable identity of the server (optional. default: url)
+	URL          string      `yaml:"url"`                             // url of the server
+	Weight       int         `yaml:"weight" env-default:"1"`          // weight of the server
+	VirtualNodes int         `yaml:"virtual_nodes" env-default:"160"` // points on the hash ring per unit of weight (optional. default: 160)
+	HealthCheck  HealthProbe `yaml:"health_check"`                    // overrides the set fields of the default health check (optional)
+}
+
+type BalancingOptions struct {
+	Maglev            Maglev            `yaml:"maglev"`
+	BoundedLoad       BoundedLoad       `yaml:"bounded_load"`
+	PeakEWMA          PeakEWMA          `yaml:"peak_ewma"`
+	LeastResponseTime LeastResponseTime `yaml:"least_response_time"`
+	SlowStart         SlowStart         `yaml:"slow_start"` // used by round_robin, weighted_round_robin, least_connections, weighted_least_connections and random
+
+	// Sections of algorithms registered outside of the balancer package,
+	// keyed by algorithm name.
+	Custom map[string]yaml.Node `yaml:",inline"`
+}
+
+type Maglev struct {
+	TableSize uint64 `yaml:"table_size" env-default:"65537"` // size of the lookup table, must be prime (optional. default: 65537)
+}
+
+type BoundedLoad struct {
+	Epsilon float64 `yaml:"epsilon" env-default:"0.25"` // allowed overload over the average in-flight requests (optional. default: 0.25)
+}
+
+type PeakEWMA struct {
+	Decay time.Duration `yaml:"decay" env-default:"10s"` // time window of the latency moving average (optional. default: 10s)
+}
+
+type LeastResponseTime struct {
+	Decay time.Duration `yaml:"decay" env-default:"10s"` // time window of the response time moving average (optional. default: 10s)
+}
+
+type SlowStart struct {
+	Window           time.Duration `yaml:"window"`                              // time a new or recovered server takes to get its full weight, 0 disables slow start (optional. default: 0)
+	Aggression       float64       `yaml:"aggression" env-default:"1"`          // the share grows as (elapsed/window)^(1/aggression), 1 is linear, higher values ramp up faster at first (optional. default: 1)
+	MinWeightPercent float64       `yaml:"min_weight_percent" env-default:"10"` // share a server starts with, in percent of its weight (optional. default: 10)
+}
+
+type HashKey struct {
+	Source   string `yaml:"source" env-default:"ip"`   // ip, path, header:<name>, cookie:<name>, query:<name> or template (optional. default: ip)
+	Template string `yaml:"template"`                  // key template used with source 'template', e.g. "{header:X-Tenant}/{cookie:session}"
+	Fallback string `yaml:"fallback" env-default:"ip"` // source used when the chosen one is missing in the request (optional. default: ip)
+}
+
+type Proxy struct {
+	PreserveHost bool   `yaml:"preserve_host"` // send the client's Host header to the servers (optional. default: false)
+	Host         string `yaml:"host"`          // Host header sent to the servers when not preserved (optional. default: server url)
+}
+
+type Upstream struct {
+	MaxIdleConns          int           `yaml:"max_idle_conns" env-default:"100"`          // idle keep-alive connections kept per server (optional. default: 100)
+	MaxConns              int           `yaml:"max_conns"`                                 // connections per server, 0 means unlimited (optional. default: 0)
+	IdleConnTimeout       time.Duration `yaml:"idle_conn_timeout" env-default:"90s"`       // how long an idle connection is kept (optional. default: 90s)
+	KeepAlive             time.Duration `yaml:"keep_alive" env-default:"30s"`              // TCP keep-alive period (optional. default: 30s)
+	DialTimeout           time.Duration `yaml:"dial_timeout" env-default:"5s"`             // timeout of establishing a connection (optional. default: 5s)
+	TLSHandshakeTimeout   time.Duration `yaml:"tls_handshake_timeout" env-default:"5s"`    // timeout of the TLS handshake with tls servers (optional. default: 5s)
+	ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout" env-default:"30s"` // time to wait for the response headers (optional. default: 30s)
+	TLS                   bool          `yaml:"tls"`                                       // send requests to servers over https (optional. default: false)
+	InsecureSkipVerify    bool          `yaml:"insecure_skip_verify"`                      // don't verify server certificates (optional. default: false)
+	HTTP2                 bool          `yaml:"http2"`                                     // negotiate HTTP/2 with tls servers (optional. default: false)
+}
+
+type Retry struct {
+	Attempts    int         `yaml:"attempts"`                                   // retries after the first try, 0 disables retries (optional. default: 0)
+	On          []string    `yaml:"on" env-default:"connect_error,502,503,504"` // connect_error, timeout or 5xx status codes (optional. default: connect_error,502,503,504)
+	AllMethods  bool        `yaml:"all_methods"`                                // retry non-idempotent methods too (optional. default: false)
+	MaxBodySize int64       `yaml:"max_body_size" env-default:"65536"`          // requests with bigger bodies are not retried (optional. default: 65536)
+	Budget      RetryBudget `yaml:"budget"`
+}
+
+type RetryBudget struct {
+	Percent    float64 `yaml:"percent" env-default:"20"`    // concurrent retries allowed, in percent of active requests (optional. default: 20)
+	MinRetries int     `yaml:"min_retries" env-default:"3"` // concurrent retries allowed regardless of the load (optional. default: 3)
+}
+
+type Hedging struct {
+	Routes []HedgeRoute `yaml:"routes"` // only idempotent requests are hedged
+}
+
+type HedgeRoute struct {
+	Path      string        `yaml:"path"`       // path prefix of the route
+	Delay     time.Duration `yaml:"delay"`      // time to wait for a response before hedging (optional. default: 50ms)
+	UseP95    bool          `yaml:"use_p95"`    // wait for the observed p95 latency of the route instead, delay is used until it is known
+	MaxHedges int           `yaml:"max_hedges"` // duplicates sent per request at most (optional. default: 1)
+}
+
+type CircuitBreaker struct {
+	Enabled             bool          `yaml:"enabled"`                            // (optional. default: false)
+	ConsecutiveFailures *int          `yaml:"consecutive_failures"`               // failures in a row that open the breaker, 0 disables the check (optional. default: 5)
+	ErrorRate           *float64      `yaml:"error_rate"`                         // failed requests in the window that open the breaker, in percent, 0 disables the check (optional. default: 50)
+	Window              time.Duration `yaml:"window" env-default:"10s"`           // rolling window of the error rate (optional. default: 10s)
+	MinRequests         int           `yaml:"min_requests" env-default:"20"`      // requests in the window needed to apply the error rate (optional. default: 20)
+	OpenTimeout         time.Duration `yaml:"open_timeout" env-default:"30s"`     // how long the breaker stays open before trial requests (optional. default: 30s)
+	HalfOpenRequests    int           `yaml:"half_open_requests" env-default:"1"` // successful trial requests that close the breaker (optional. default: 1)
+}
+
+type OutlierDetection struct {
+	Enabled                   bool          `yaml:"enabled"`                                       // (optional. default: false)
+	Interval                  time.Duration `yaml:"interval" env-default:"10s"`                    // interval of the success rate analysis and of returning ejected servers (optional. default: 10s)
+	Consecutive5xx            *int          `yaml:"consecutive_5xx"`                               // 5xx responses in a row that eject the server, 0 disables the check (optional. default: 5)
+	ConsecutiveGatewayFailure *int          `yaml:"consecutive_gateway_failure"`                   // 502, 503, 504 or connection errors in a row that eject the server, 0 disables the check (optional. default: 5)
+	SuccessRateMinHosts       int           `yaml:"success_rate_min_hosts" env-default:"5"`        // servers with enough requests needed for the success rate analysis (optional. default: 5)
+	SuccessRateRequestVolume  int           `yaml:"success_rate_request_volume" env-default:"100"` // requests in the interval needed to include a server in the analysis (optional. default: 100)
+	SuccessRateStdevFactor    *float64      `yaml:"success_rate_stdev_factor"`                     // servers below mean - factor x stdev are ejected, 0 disables the analysis (optional. default: 1.9)
+	BaseEjectionTime          time.Duration `yaml:"base_ejection_time" env-default:"30s"`          // ejection time, multiplied by the number of ejections of the server (optional. default: 30s)
+	MaxEjectionTime           time.Duration `yaml:"max_ejection_time" env-default:"300s"`          // (optional. default: 300s)
+	MaxEjectionPercent        float64       `yaml:"max_ejection_percent" env-default:"10"`         // servers ejected at once, in percent of all servers, at least one may always be ejected (optional. default: 10)
 }
 
 type Health struct {
-	Interval time.Duration `yaml:"interval"` // interval between health checks
-	Timeout  time.Duration `yaml:"timeout"`  // timeout for health checks (optional. default: 2s)        `yaml:"timeout"`  // timeout for health checks
+	Interval    time.Duration    `yaml:"interval" env-default:"5s"`    // interval between health checks (optional. default: 5s)
+	Timeout     time.Duration    `yaml:"timeout" env-default:"2s"`     // timeout for health checks (optional. default: 2s)
+	Concurrency int              `yaml:"concurrency" env-default:"10"` // health checks run at once (optional. default: 10)
+	Jitter      *time.Duration   `yaml:"jitter"`                       // random delay before every health check, 0s disables it (optional. default: 500ms)
+	Rise        int              `yaml:"rise" env-default:"2"`         // successful checks in a row that make a down server alive (optional. default: 2)
+	Fall        int              `yaml:"fall" env-default:"3"`         // failed checks in a row that make an alive server down (optional. default: 3)
+	MaxBackoff  time.Duration    `yaml:"max_backoff" env-default:"1m"` // down servers are checked at doubling intervals up to max_backoff (optional. default: 1m)
+	HealthProbe `yaml:",inline"` // default health check of every server
+}
+
+type HealthProbe struct {
+	Protocol string     `yaml:"protocol"` // http, tcp or grpc (optional. default: http)
+	HTTP     HealthHTTP `yaml:"http"`
+	TCP      HealthTCP  `yaml:"tcp"`
+	GRPC     HealthGRPC `yaml:"grpc"`
+}
+
+type HealthHTTP struct {
+	Path               string            `yaml:"path" env-default:"/health"`        // (optional. default: /health)
+	Method             string            `yaml:"method" env-default:"GET"`          // (optional. default: GET)
+	Headers            map[string]string `yaml:"headers"`                           // request headers (optional)
+	Host               string            `yaml:"host"`                              // Host header of the request (optional. default: server url)
+	ExpectedStatus     []string          `yaml:"expected_status" env-default:"200"` // status codes or ranges like 200-399 (optional. default: 200)
+	Body               string            `yaml:"body"`                              // substring the response body must contain (optional)
+	BodyRegex          string            `yaml:"body_regex"`                        // regular expression the response body must match (optional)
+	HTTPS              *bool             `yaml:"https"`                             // (optional. default: false)
+	InsecureSkipVerify *bool             `yaml:"insecure_skip_verify"`              // don't verify the server certificate (optional. default: false)
+}
+
+type HealthTCP struct {
+	Send   string `yaml:"send"`   // payload written after connecting (optional)
+	Expect string `yaml:"expect"` // substring the reply must contain, only the connection is checked when send and expect are empty (optional)
+}
+
+type HealthGRPC struct {
+	Service            string `yaml:"service"`              // service name of the grpc.health.v1 request, empty checks the whole server (optional)
+	TLS                *bool  `yaml:"tls"`                  // (optional. default: false)
+	InsecureSkipVerify *bool  `yaml:"insecure_skip_verify"` // don't verify the server certificate (optional. default: false)
+}
+
+type Drain struct {
+	Timeout time.Duration `yaml:"timeout" env-default:"30s"` // how long in-flight requests are waited for (optional. default: 30s)
+	Remove  bool          `yaml:"remove"`                    // remove drained servers instead of keeping them in maintenance until they are enabled (optional. default: false)
+}
+
+type Events struct {
+	Webhooks Webhooks `yaml:"webhooks"`
+}
+
+type Webhooks struct {
+	URLs       []string      `yaml:"urls"`                          // events are POSTed as JSON to every url (optional)
+	Timeout    time.Duration `yaml:"timeout" env-default:"5s"`      // (optional. default: 5s)
+	Attempts   int           `yaml:"attempts" env-default:"5"`      // deliveries tried per event (optional. default: 5)
+	Backoff    time.Duration `yaml:"backoff" env-default:"1s"`      // delay before the first retry, doubled after every failed one (optional. default: 1s)
+	MaxBackoff time.Duration `yaml:"max_backoff" env-default:"30s"` // (optional. default: 30s)
+	QueueSize  int           `yaml:"queue_size" env-default:"1024"` // events waiting for delivery per url, newer ones are dropped (optional. default: 1024)
 }
 
 type Logging struct {
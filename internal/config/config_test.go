@@ -0,0 +1,78 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+// readConfig loads yaml like NewConfig does.
+func readConfig(t *testing.T, yaml string) Config {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg Config
+	if err := cleanenv.ReadConfig(path, &cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	return cfg
+}
+
+func TestCircuitBreakerZeroDisables(t *testing.T) {
+	cfg := readConfig(t, `
+circuit_breaker:
+  consecutive_failures: 0
+  error_rate: 0
+`)
+
+	if v := cfg.Breaker.ConsecutiveFailures; v == nil || *v != 0 {
+		t.Errorf("consecutive_failures = %v, want 0", v)
+	}
+	if v := cfg.Breaker.ErrorRate; v == nil || *v != 0 {
+		t.Errorf("error_rate = %v, want 0", v)
+	}
+
+	unset := readConfig(t, "circuit_breaker:\n  enabled: true\n")
+	if unset.Breaker.ConsecutiveFailures != nil || unset.Breaker.ErrorRate != nil {
+		t.Error("unset thresholds are not nil, their defaults can't be told apart")
+	}
+}
+
+func TestOutlierDetectionZeroDisables(t *testing.T) {
+	cfg := readConfig(t, `
+outlier_detection:
+  consecutive_5xx: 0
+  consecutive_gateway_failure: 0
+  success_rate_stdev_factor: 0
+`)
+
+	if v := cfg.Outlier.Consecutive5xx; v == nil || *v != 0 {
+		t.Errorf("consecutive_5xx = %v, want 0", v)
+	}
+	if v := cfg.Outlier.ConsecutiveGatewayFailure; v == nil || *v != 0 {
+		t.Errorf("consecutive_gateway_failure = %v, want 0", v)
+	}
+	if v := cfg.Outlier.SuccessRateStdevFactor; v == nil || *v != 0 {
+		t.Errorf("success_rate_stdev_factor = %v, want 0", v)
+	}
+}
+
+func TestHealthCheckJitter(t *testing.T) {
+	cfg := readConfig(t, "health_check:\n  jitter: 0s\n")
+	if v := cfg.HealthCheck.Jitter; v == nil || *v != 0 {
+		t.Errorf("jitter = %v, want 0", v)
+	}
+
+	cfg = readConfig(t, "health_check:\n  jitter: 250ms\n")
+	if v := cfg.HealthCheck.Jitter; v == nil || *v != 250*time.Millisecond {
+		t.Errorf("jitter = %v, want 250ms", v)
+	}
+}
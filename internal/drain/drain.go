@@ -0,0 +1,168 @@
+package drain
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+// pollInterval is how often the in-flight requests of a draining backend
+// are checked.
+const pollInterval = 100 * time.Millisecond
+
+var ErrNotFound = errors.New("backend not found")
+
+// Drainer takes backends out of selection without dropping their in-flight
+// requests. Once those finished or the timeout passed, the backend is removed
+// or put in maintenance, where health checks don't bring it back until it is
+// enabled.
+type Drainer struct {
+	log      *slog.Logger
+	registry *server.Registry
+	timeout  time.Duration
+	remove   bool
+
+	// mu serializes the state changes of the drainer, so a wait can not
+	// finish a drain that was enabled or restarted in the meantime.
+	mu    sync.Mutex
+	stops map[string]chan struct{} // by backend ID, closed to end the wait of a drain
+}
+
+func NewDrainer(log *slog.Logger, registry *server.Registry, cfg config.Drain) *Drainer {
+	return &Drainer{
+		log:      log,
+		registry: registry,
+		timeout:  cfg.Timeout,
+		remove:   cfg.Remove,
+		stops:    make(map[string]chan struct{}),
+	}
+}
+
+// Drain starts draining the backend. Draining a backend twice is a no-op.
+func (d *Drainer) Drain(id string) error {
+	backend, ok := d.registry.Get(id)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrNotFound, id)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	changed, err := d.registry.SetState(id, server.StateDraining)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return nil
+	}
+
+	d.log.Info("DRAIN: server is draining", slog.String("server", backend.URL), slog.Int64("in_flight", backend.CurrentConnections()))
+
+	// A wait of an earlier drain that was not ended by Enable must not end
+	// this one.
+	d.stopLocked(id)
+	stop := make(chan struct{})
+	d.stops[id] = stop
+
+	go d.wait(backend, stop)
+
+	return nil
+}
+
+// Enable hands a backend in maintenance, or still draining, back to the health
+// checks, which bring it back once it passes them. Enabling any other backend
+// is a no-op.
+func (d *Drainer) Enable(id string) error {
+	backend, ok := d.registry.Get(id)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrNotFound, id)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, from := range []server.State{server.StateMaintenance, server.StateDraining} {
+		changed, err := d.registry.CompareAndSetState(id, from, server.StateDown)
+		if err != nil {
+			return err
+		}
+		if changed {
+			d.stopLocked(id)
+			d.log.Info("DRAIN: server is enabled", slog.String("server", backend.URL), slog.String("from", from.String()))
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// DrainAll drains every registered backend.
+func (d *Drainer) DrainAll() {
+	for _, backend := range d.registry.Backends() {
+		if err := d.Drain(backend.ID); err != nil {
+			d.log.Error("DRAIN: failed to drain server", slog.String("server", backend.URL), slog.String("error", err.Error()))
+		}
+	}
+}
+
+func (d *Drainer) wait(backend *server.Backend, stop chan struct{}) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	deadline := time.Now().Add(d.timeout)
+	for backend.CurrentConnections() > 0 && time.Now().Before(deadline) {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	select {
+	case <-stop:
+		return
+	default:
+	}
+	delete(d.stops, backend.ID)
+
+	if inFlight := backend.CurrentConnections(); inFlight > 0 {
+		d.log.Warn("DRAIN: timed out waiting for in-flight requests", slog.String("server", backend.URL), slog.Int64("in_flight", inFlight))
+	}
+
+	var (
+		changed bool
+		err     error
+	)
+	if d.remove {
+		changed, err = d.registry.CompareAndRemove(backend.ID, server.StateDraining)
+	} else {
+		changed, err = d.registry.CompareAndSetState(backend.ID, server.StateDraining, server.StateMaintenance)
+	}
+
+	if err != nil {
+		d.log.Error("DRAIN: failed to update server", slog.String("server", backend.URL), slog.String("error", err.Error()))
+		return
+	}
+	if !changed {
+		return
+	}
+
+	d.log.Info("DRAIN: server is drained", slog.String("server", backend.URL), slog.Bool("removed", d.remove))
+}
+
+// stopLocked ends the wait of the backend's drain if there is one. Must be
+// called with mu held.
+func (d *Drainer) stopLocked(id string) {
+	if stop, ok := d.stops[id]; ok {
+		close(stop)
+		delete(d.stops, id)
+	}
+}
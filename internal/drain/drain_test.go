@@ -0,0 +1,170 @@
+package drain
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+func newTestDrainer(t *testing.T, cfg config.Drain) (*Drainer, *server.Backend) {
+	t.Helper()
+
+	backend := server.NewBackend("backend-1", "http://backend-1", 1, 0)
+	registry := server.NewRegistry()
+	if err := registry.Add(backend); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewDrainer(slog.New(slog.NewTextHandler(io.Discard, nil)), registry, cfg), backend
+}
+
+// waitState waits for backend to reach state.
+func waitState(t *testing.T, backend *server.Backend, state server.State) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for backend.State() != state {
+		if time.Now().After(deadline) {
+			t.Fatalf("backend is %s, want %s", backend.State(), state)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDrainWaitsForInFlightRequests(t *testing.T) {
+	d, backend := newTestDrainer(t, config.Drain{Timeout: time.Minute})
+
+	backend.IncrementConnections()
+	if err := d.Drain(backend.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(3 * pollInterval)
+	if state := backend.State(); state != server.StateDraining {
+		t.Fatalf("backend with a request in flight is %s, want draining", state)
+	}
+
+	backend.DecrementConnections()
+	waitState(t, backend, server.StateMaintenance)
+}
+
+func TestDrainTimeout(t *testing.T) {
+	d, backend := newTestDrainer(t, config.Drain{Timeout: pollInterval})
+
+	backend.IncrementConnections()
+	if err := d.Drain(backend.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	waitState(t, backend, server.StateMaintenance)
+}
+
+func TestDrainRemove(t *testing.T) {
+	d, backend := newTestDrainer(t, config.Drain{Timeout: time.Minute, Remove: true})
+
+	if err := d.Drain(backend.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	waitState(t, backend, server.StateRemoved)
+	if _, ok := d.registry.Get(backend.ID); ok {
+		t.Error("drained backend is still registered")
+	}
+}
+
+func TestEnable(t *testing.T) {
+	tests := []struct {
+		name string
+		from server.State
+		want server.State
+	}{
+		{name: "maintenance", from: server.StateMaintenance, want: server.StateDown},
+		{name: "draining", from: server.StateDraining, want: server.StateDown},
+		{name: "alive", from: server.StateAlive, want: server.StateAlive},
+		{name: "down", from: server.StateDown, want: server.StateDown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, backend := newTestDrainer(t, config.Drain{})
+			if _, err := d.registry.SetState(backend.ID, tt.from); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := d.Enable(backend.ID); err != nil {
+				t.Fatal(err)
+			}
+
+			if state := backend.State(); state != tt.want {
+				t.Errorf("enabled backend is %s, want %s", state, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnableCancelsDrain(t *testing.T) {
+	for _, remove := range []bool{false, true} {
+		t.Run(fmt.Sprintf("remove=%t", remove), func(t *testing.T) {
+			d, backend := newTestDrainer(t, config.Drain{Timeout: time.Minute, Remove: remove})
+
+			backend.IncrementConnections()
+			if err := d.Drain(backend.ID); err != nil {
+				t.Fatal(err)
+			}
+			if err := d.Enable(backend.ID); err != nil {
+				t.Fatal(err)
+			}
+
+			backend.DecrementConnections()
+			time.Sleep(3 * pollInterval)
+			if state := backend.State(); state != server.StateDown {
+				t.Errorf("backend is %s after its drain was canceled, want down", state)
+			}
+			if _, ok := d.registry.Get(backend.ID); !ok {
+				t.Error("backend was removed after its drain was canceled")
+			}
+		})
+	}
+}
+
+func TestDrainAgainKeepsItsTimeout(t *testing.T) {
+	timeout := 4 * pollInterval
+	d, backend := newTestDrainer(t, config.Drain{Timeout: timeout})
+
+	backend.IncrementConnections()
+	if err := d.Drain(backend.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(timeout / 2)
+	if err := d.Enable(backend.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Drain(backend.ID); err != nil {
+		t.Fatal(err)
+	}
+	drained := time.Now()
+
+	// The deadline of the first drain passes before the second one's.
+	waitState(t, backend, server.StateMaintenance)
+	if elapsed := time.Since(drained); elapsed < timeout*3/4 {
+		t.Errorf("second drain ended after %s, want its own timeout %s", elapsed, timeout)
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	d, _ := newTestDrainer(t, config.Drain{})
+
+	if err := d.Drain("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Drain error = %v, want ErrNotFound", err)
+	}
+	if err := d.Enable("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Enable error = %v, want ErrNotFound", err)
+	}
+}
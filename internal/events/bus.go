@@ -0,0 +1,125 @@
+package events
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+const (
+	TypeStateChanged = "state_changed" // health checks and draining
+	TypeExcluded     = "excluded"      // ejections and open circuit breakers
+	TypeIncluded     = "included"
+)
+
+type Event struct {
+	Type   string    `json:"type"`
+	Server string    `json:"server"` // backend ID
+	URL    string    `json:"url"`
+	From   string    `json:"from,omitempty"`   // state before a state change
+	To     string    `json:"to,omitempty"`     // state after a state change
+	Reason string    `json:"reason,omitempty"` // reason of an exclusion, e.g. outlier or circuit_breaker
+	Time   time.Time `json:"time"`
+}
+
+// Bus fans events out to subscribers. Publishing never blocks, events are
+// dropped for subscribers that fall behind.
+type Bus struct {
+	log *slog.Logger
+
+	mu     sync.Mutex
+	subs   map[chan Event]struct{}
+	closed bool
+	done   chan struct{} // closed by Close, interrupts webhook backoffs
+}
+
+func NewBus(log *slog.Logger) *Bus {
+	return &Bus{
+		log:  log,
+		subs: make(map[chan Event]struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+// Watch publishes the state changes and exclusions of the registry's
+// backends.
+func (b *Bus) Watch(registry *server.Registry) {
+	registry.Watch(func(c server.Change) {
+		e := Event{
+			Type:   TypeStateChanged,
+			Server: c.Backend.ID,
+			URL:    c.Backend.URL,
+			Time:   time.Now(),
+		}
+
+		switch {
+		case c.Reason == "":
+			e.From, e.To = c.From.String(), c.To.String()
+		case c.Excluded:
+			e.Type, e.Reason = TypeExcluded, c.Reason
+		default:
+			e.Type, e.Reason = TypeIncluded, c.Reason
+		}
+
+		b.Publish(e)
+	})
+}
+
+func (b *Bus) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			b.log.Warn("EVENTS: subscriber is behind, event dropped", slog.String("type", e.Type), slog.String("server", e.Server))
+		}
+	}
+}
+
+// Subscribe returns a channel of the events published from now on, buffering
+// up to size of them. The channel is closed by the returned function or by
+// Close.
+func (b *Bus) Subscribe(size int) (<-chan Event, func()) {
+	ch := make(chan Event, size)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	b.subs[ch] = struct{}{}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Close closes the channels of all subscribers, ending event streams so
+// servers can shut down.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	b.closed = true
+	close(b.done)
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
@@ -0,0 +1,149 @@
+package events
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+func newTestBus() *Bus {
+	return NewBus(slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+// receive returns the next event of ch or fails after a second.
+func receive(t *testing.T, ch <-chan Event) Event {
+	t.Helper()
+
+	select {
+	case e, ok := <-ch:
+		if !ok {
+			t.Fatal("channel closed, want an event")
+		}
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+		return Event{}
+	}
+}
+
+func TestBusFansOut(t *testing.T) {
+	bus := newTestBus()
+	first, _ := bus.Subscribe(1)
+	second, _ := bus.Subscribe(1)
+
+	bus.Publish(Event{Type: TypeExcluded, Server: "a"})
+
+	for _, ch := range []<-chan Event{first, second} {
+		if e := receive(t, ch); e.Type != TypeExcluded || e.Server != "a" {
+			t.Errorf("got %+v, want the excluded event of a", e)
+		}
+	}
+}
+
+func TestBusDropsEventsForSlowSubscribers(t *testing.T) {
+	bus := newTestBus()
+	slow, _ := bus.Subscribe(1)
+	fast, _ := bus.Subscribe(2)
+
+	// Publishing never waits for the slow subscriber.
+	bus.Publish(Event{Server: "a"})
+	bus.Publish(Event{Server: "b"})
+
+	if e := receive(t, slow); e.Server != "a" {
+		t.Errorf("slow subscriber got %s, want a", e.Server)
+	}
+	select {
+	case e := <-slow:
+		t.Errorf("slow subscriber got %s, want it dropped", e.Server)
+	default:
+	}
+
+	for _, want := range []string{"a", "b"} {
+		if e := receive(t, fast); e.Server != want {
+			t.Errorf("fast subscriber got %s, want %s", e.Server, want)
+		}
+	}
+}
+
+func TestBusUnsubscribe(t *testing.T) {
+	bus := newTestBus()
+	ch, unsubscribe := bus.Subscribe(1)
+
+	unsubscribe()
+	unsubscribe()
+	bus.Publish(Event{Server: "a"})
+
+	if _, ok := <-ch; ok {
+		t.Error("got an event after unsubscribing")
+	}
+}
+
+func TestBusClose(t *testing.T) {
+	bus := newTestBus()
+	ch, unsubscribe := bus.Subscribe(1)
+
+	bus.Close()
+	bus.Close()
+	unsubscribe()
+
+	if _, ok := <-ch; ok {
+		t.Error("channel is open after Close")
+	}
+
+	late, _ := bus.Subscribe(1)
+	if _, ok := <-late; ok {
+		t.Error("subscribing after Close returned an open channel")
+	}
+
+	select {
+	case <-bus.done:
+	default:
+		t.Error("done is not closed")
+	}
+}
+
+func TestBusWatch(t *testing.T) {
+	registry := server.NewRegistry()
+	backend := server.NewBackend("a", "http://a", 1, 0)
+	if err := registry.Add(backend); err != nil {
+		t.Fatal(err)
+	}
+
+	bus := newTestBus()
+	bus.Watch(registry)
+	ch, _ := bus.Subscribe(8)
+
+	if _, err := registry.SetState("a", server.StateDown); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.SetState("a", server.StateAlive); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Exclude("a", "outlier"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Include("a", "outlier"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Event{
+		{Type: TypeStateChanged, From: server.StateAlive.String(), To: server.StateDown.String()},
+		{Type: TypeStateChanged, From: server.StateDown.String(), To: server.StateAlive.String()},
+		{Type: TypeExcluded, Reason: "outlier"},
+		{Type: TypeIncluded, Reason: "outlier"},
+	}
+	for _, w := range want {
+		e := receive(t, ch)
+		if e.Server != "a" || e.URL != "http://a" || e.Time.IsZero() {
+			t.Errorf("got %+v, want an event of a with its url and time", e)
+		}
+
+		e.Server, e.URL, e.Time = "", "", time.Time{}
+		if e != w {
+			t.Errorf("got %+v, want %+v", e, w)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+)
+
+// StartWebhooks POSTs every event of the bus as JSON to the configured urls.
+// Each url gets its events in order, failed deliveries are retried with
+// exponential backoff until the bus is closed.
+func StartWebhooks(log *slog.Logger, bus *Bus, cfg config.Webhooks) {
+	client := &http.Client{Timeout: cfg.Timeout}
+
+	for _, url := range cfg.URLs {
+		events, _ := bus.Subscribe(max(cfg.QueueSize, 1))
+
+		go func() {
+			for e := range events {
+				deliver(log, client, url, e, cfg, bus.done)
+			}
+		}()
+	}
+}
+
+func deliver(log *slog.Logger, client *http.Client, url string, e Event, cfg config.Webhooks, done <-chan struct{}) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		log.Error("EVENTS: failed to encode event", slog.String("error", err.Error()))
+		return
+	}
+
+	backoff := cfg.Backoff
+	for attempt := 1; ; attempt++ {
+		err := post(client, url, body)
+		if err == nil {
+			return
+		}
+
+		if attempt >= cfg.Attempts {
+			log.Error("EVENTS: webhook failed, event dropped", slog.String("url", url), slog.String("type", e.Type), slog.String("server", e.Server), slog.Int("attempts", attempt), slog.String("error", err.Error()))
+			return
+		}
+
+		log.Warn("EVENTS: webhook failed, retrying", slog.String("url", url), slog.Duration("backoff", backoff), slog.String("error", err.Error()))
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-done:
+			timer.Stop()
+			log.Warn("EVENTS: bus closed, event dropped", slog.String("url", url), slog.String("type", e.Type), slog.String("server", e.Server))
+			return
+		}
+		backoff = min(backoff*2, max(cfg.MaxBackoff, cfg.Backoff))
+	}
+}
+
+func post(client *http.Client, url string, body []byte) error {
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
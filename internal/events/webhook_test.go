@@ -0,0 +1,145 @@
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+)
+
+type delivery struct {
+	event Event
+	at    time.Time
+}
+
+// newTestWebhook records the deliveries it got, failing the first failures
+// of them with a 500.
+func newTestWebhook(t *testing.T, failures int64) (string, <-chan delivery) {
+	t.Helper()
+
+	deliveries := make(chan delivery, 16)
+	var calls atomic.Int64
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Errorf("failed to decode event: %v", err)
+		}
+		deliveries <- delivery{event: e, at: time.Now()}
+
+		if calls.Add(1) <= failures {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv.URL, deliveries
+}
+
+func receiveDelivery(t *testing.T, deliveries <-chan delivery) delivery {
+	t.Helper()
+
+	select {
+	case d := <-deliveries:
+		return d
+	case <-time.After(2 * time.Second):
+		t.Fatal("no delivery received")
+		return delivery{}
+	}
+}
+
+func TestWebhookRetriesWithBackoff(t *testing.T) {
+	url, deliveries := newTestWebhook(t, 3)
+
+	bus := newTestBus()
+	t.Cleanup(bus.Close)
+	StartWebhooks(bus.log, bus, config.Webhooks{
+		URLs:       []string{url},
+		Timeout:    time.Second,
+		Attempts:   5,
+		Backoff:    20 * time.Millisecond,
+		MaxBackoff: 30 * time.Millisecond,
+		QueueSize:  8,
+	})
+
+	bus.Publish(Event{Type: TypeExcluded, Server: "a", Reason: "outlier"})
+
+	// Failed three times, delivered on the fourth attempt, after backoffs of
+	// 20ms, 30ms and 30ms.
+	prev := receiveDelivery(t, deliveries)
+	for _, backoff := range []time.Duration{20 * time.Millisecond, 30 * time.Millisecond, 30 * time.Millisecond} {
+		d := receiveDelivery(t, deliveries)
+		if gap := d.at.Sub(prev.at); gap < backoff {
+			t.Errorf("retried after %s, want a backoff of %s", gap, backoff)
+		}
+		if d.event.Server != "a" || d.event.Reason != "outlier" {
+			t.Errorf("delivered %+v, want the excluded event of a", d.event)
+		}
+		prev = d
+	}
+
+	// The next event is delivered once.
+	bus.Publish(Event{Type: TypeIncluded, Server: "a", Reason: "outlier"})
+	if d := receiveDelivery(t, deliveries); d.event.Type != TypeIncluded {
+		t.Errorf("delivered %s, want %s", d.event.Type, TypeIncluded)
+	}
+	select {
+	case d := <-deliveries:
+		t.Errorf("delivered %s again", d.event.Type)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWebhookDropsEventAfterAttempts(t *testing.T) {
+	url, deliveries := newTestWebhook(t, 2)
+
+	bus := newTestBus()
+	t.Cleanup(bus.Close)
+	StartWebhooks(bus.log, bus, config.Webhooks{
+		URLs:       []string{url},
+		Timeout:    time.Second,
+		Attempts:   2,
+		Backoff:    time.Millisecond,
+		MaxBackoff: time.Millisecond,
+		QueueSize:  8,
+	})
+
+	bus.Publish(Event{Server: "a"})
+	bus.Publish(Event{Server: "b"})
+
+	// Events are delivered in order, a is given up after two attempts.
+	for _, want := range []string{"a", "a", "b"} {
+		if d := receiveDelivery(t, deliveries); d.event.Server != want {
+			t.Errorf("delivered the event of %s, want %s", d.event.Server, want)
+		}
+	}
+}
+
+func TestWebhookBackoffInterruptedByClose(t *testing.T) {
+	url, deliveries := newTestWebhook(t, 1)
+
+	done := make(chan struct{})
+	returned := make(chan struct{})
+	go func() {
+		defer close(returned)
+		deliver(slog.New(slog.NewTextHandler(io.Discard, nil)), http.DefaultClient, url, Event{Server: "a"}, config.Webhooks{
+			Attempts: 5,
+			Backoff:  time.Minute,
+		}, done)
+	}()
+
+	receiveDelivery(t, deliveries)
+	close(done)
+
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("delivery kept waiting for its backoff after close")
+	}
+}
@@ -0,0 +1,108 @@
+package healthcheck
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+	"github.com/dzhordano/balancer-go/internal/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// grpcProbe calls grpc.health.v1.Health/Check and expects SERVING. The
+// connections are kept between checks and closed by Close.
+type grpcProbe struct {
+	service string
+	creds   credentials.TransportCredentials
+
+	mu    sync.Mutex
+	conns map[string]*grpc.ClientConn // by backend ID
+}
+
+func newGRPCProbe(cfg config.HealthGRPC) *grpcProbe {
+	creds := insecure.NewCredentials()
+	if enabled(cfg.TLS) {
+		creds = credentials.NewTLS(&tls.Config{InsecureSkipVerify: enabled(cfg.InsecureSkipVerify)})
+	}
+
+	return &grpcProbe{
+		service: cfg.Service,
+		creds:   creds,
+		conns:   make(map[string]*grpc.ClientConn),
+	}
+}
+
+func (p *grpcProbe) probe(ctx context.Context, backend *server.Backend) error {
+	conn, err := p.conn(backend)
+	if err != nil {
+		return err
+	}
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: p.service})
+	if err != nil {
+		return fmt.Errorf("failed to get health check: %w", err)
+	}
+
+	if status := resp.GetStatus(); status != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("unexpected serving status %s", status)
+	}
+
+	return nil
+}
+
+func (p *grpcProbe) conn(backend *server.Backend) (*grpc.ClientConn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conns == nil {
+		return nil, errors.New("probe is closed")
+	}
+
+	if conn, ok := p.conns[backend.ID]; ok {
+		return conn, nil
+	}
+
+	conn, err := grpc.NewClient(backend.URL, grpc.WithTransportCredentials(p.creds))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create grpc client: %w", err)
+	}
+	p.conns[backend.ID] = conn
+
+	return conn, nil
+}
+
+// Close closes the connections to every backend.
+func (p *grpcProbe) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var errs []error
+	for _, conn := range p.conns {
+		errs = append(errs, conn.Close())
+	}
+	p.conns = nil
+
+	return errors.Join(errs...)
+}
+
+func mergeGRPC(def, override config.HealthGRPC) config.HealthGRPC {
+	merged := def
+
+	if override.Service != "" {
+		merged.Service = override.Service
+	}
+	if override.TLS != nil {
+		merged.TLS = override.TLS
+	}
+	if override.InsecureSkipVerify != nil {
+		merged.InsecureSkipVerify = override.InsecureSkipVerify
+	}
+
+	return merged
+}
@@ -0,0 +1,221 @@
+package healthcheck
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"log/slog"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+	"github.com/dzhordano/balancer-go/internal/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// listenGRPC starts a gRPC server with the standard health service on a
+// local listener. A self-signed certificate is used if useTLS.
+func listenGRPC(t *testing.T, useTLS bool) (*server.Backend, *health.Server) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var opts []grpc.ServerOption
+	if useTLS {
+		// Borrow the self-signed certificate of httptest.
+		ts := httptest.NewTLSServer(nil)
+		cert := ts.TLS.Certificates[0]
+		ts.Close()
+
+		opts = append(opts, grpc.Creds(credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{cert}})))
+	}
+
+	srv := grpc.NewServer(opts...)
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(srv, hs)
+
+	go srv.Serve(ln)
+	t.Cleanup(srv.Stop)
+
+	return server.NewBackend("", ln.Addr().String(), 1, 0), hs
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestGRPCProbe(t *testing.T) {
+	tests := []struct {
+		name    string
+		tls     bool
+		cfg     config.HealthGRPC
+		status  map[string]healthpb.HealthCheckResponse_ServingStatus // by service
+		wantErr string
+	}{
+		{name: "serving", cfg: config.HealthGRPC{}},
+		{
+			name:    "not serving",
+			status:  map[string]healthpb.HealthCheckResponse_ServingStatus{"": healthpb.HealthCheckResponse_NOT_SERVING},
+			wantErr: "unexpected serving status NOT_SERVING",
+		},
+		{
+			name:   "service serving",
+			cfg:    config.HealthGRPC{Service: "orders.v1.Orders"},
+			status: map[string]healthpb.HealthCheckResponse_ServingStatus{"orders.v1.Orders": healthpb.HealthCheckResponse_SERVING},
+		},
+		{
+			name:    "unknown service",
+			cfg:     config.HealthGRPC{Service: "billing.v1.Billing"},
+			wantErr: "NotFound",
+		},
+		{name: "tls", tls: true, cfg: config.HealthGRPC{TLS: ptr(true), InsecureSkipVerify: ptr(true)}},
+		{
+			name:    "tls with verification",
+			tls:     true,
+			cfg:     config.HealthGRPC{TLS: ptr(true)},
+			wantErr: "certificate",
+		},
+		{
+			name:    "plaintext to tls server",
+			tls:     true,
+			cfg:     config.HealthGRPC{TLS: ptr(false)},
+			wantErr: "failed to get health check",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend, hs := listenGRPC(t, tt.tls)
+			for service, status := range tt.status {
+				hs.SetServingStatus(service, status)
+			}
+
+			p := newGRPCProbe(tt.cfg)
+			defer p.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			checkErr(t, p.probe(ctx, backend), tt.wantErr)
+		})
+	}
+}
+
+func TestGRPCProbeReusesConnection(t *testing.T) {
+	backend, _ := listenGRPC(t, false)
+
+	p := newGRPCProbe(config.HealthGRPC{})
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	for range 3 {
+		if err := p.probe(ctx, backend); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(p.conns) != 1 {
+		t.Errorf("%d connections, want 1", len(p.conns))
+	}
+}
+
+func TestHealthCheckerStopClosesGRPCConnections(t *testing.T) {
+	backend, _ := listenGRPC(t, false)
+
+	registry := server.NewRegistry()
+	if err := registry.Add(backend); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		Servers: []config.Server{{URL: backend.URL}},
+		HealthCheck: config.Health{
+			Interval:    time.Hour,
+			Timeout:     time.Second,
+			Concurrency: 1,
+			HealthProbe: config.HealthProbe{Protocol: "grpc"},
+		},
+	}
+
+	checker, err := NewHealthChecker(slog.New(slog.NewTextHandler(io.Discard, nil)), registry, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hl := checker.(*hc)
+
+	if _, err := hl.probe(backend); err != nil {
+		t.Fatal(err)
+	}
+
+	p := hl.probes[backend.ID].(*grpcProbe)
+	conn := p.conns[backend.ID]
+
+	if err := checker.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if state := conn.GetState(); state != connectivity.Shutdown {
+		t.Errorf("connection is %s after Stop, want %s", state, connectivity.Shutdown)
+	}
+
+	// Stopping twice is fine.
+	if err := checker.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMergeGRPC(t *testing.T) {
+	tests := []struct {
+		name          string
+		def, override config.HealthGRPC
+		wantService   string
+		wantTLS       bool
+		wantSkip      bool
+	}{
+		{
+			name:        "unset keeps the default",
+			def:         config.HealthGRPC{Service: "a", TLS: ptr(true), InsecureSkipVerify: ptr(true)},
+			wantService: "a",
+			wantTLS:     true,
+			wantSkip:    true,
+		},
+		{
+			name:     "override enables",
+			override: config.HealthGRPC{TLS: ptr(true), InsecureSkipVerify: ptr(true)},
+			wantTLS:  true,
+			wantSkip: true,
+		},
+		{
+			name:        "override disables",
+			def:         config.HealthGRPC{Service: "a", TLS: ptr(true), InsecureSkipVerify: ptr(true)},
+			override:    config.HealthGRPC{Service: "b", TLS: ptr(false), InsecureSkipVerify: ptr(false)},
+			wantService: "b",
+		},
+		{
+			name:     "override restores verification only",
+			def:      config.HealthGRPC{TLS: ptr(true), InsecureSkipVerify: ptr(true)},
+			override: config.HealthGRPC{InsecureSkipVerify: ptr(false)},
+			wantTLS:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeGRPC(tt.def, tt.override)
+			if got.Service != tt.wantService || enabled(got.TLS) != tt.wantTLS || enabled(got.InsecureSkipVerify) != tt.wantSkip {
+				t.Errorf("merged = {%s %v %v}, want {%s %v %v}", got.Service, enabled(got.TLS), enabled(got.InsecureSkipVerify), tt.wantService, tt.wantTLS, tt.wantSkip)
+			}
+		})
+	}
+}
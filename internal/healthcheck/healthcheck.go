@@ -1,106 +1,360 @@
 package healthcheck
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log/slog"
-	"net/http"
+	"math/rand/v2"
+	"sync"
 	"time"
 
-	"github.com/dzhordano/balancer-go/internal/balancer"
+	"github.com/dzhordano/balancer-go/internal/config"
+	"github.com/dzhordano/balancer-go/internal/server"
 )
 
 type HealthChecker interface {
+	// HealthCheck checks the backends until Stop is called.
 	HealthCheck()
+	// Stop stops the checks and waits for the running ones to finish or ctx
+	// to be done.
+	Stop(ctx context.Context) error
 }
 
+// prober checks whether a backend is healthy. The context carries the
+// health check timeout. Probers holding connections implement io.Closer,
+// they are closed by Stop.
+type prober interface {
+	probe(ctx context.Context, backend *server.Backend) error
+}
+
+func newProber(cfg config.HealthProbe) (prober, error) {
+	switch cfg.Protocol {
+	case "", "http":
+		return newHTTPProbe(cfg.HTTP)
+	case "tcp":
+		return newTCPProbe(cfg.TCP), nil
+	case "grpc":
+		return newGRPCProbe(cfg.GRPC), nil
+	default:
+		return nil, fmt.Errorf("unknown health check protocol %q", cfg.Protocol)
+	}
+}
+
+// enabled reports whether an optional switch is set and true.
+func enabled(b *bool) bool {
+	return b != nil && *b
+}
+
+// mergeProbe returns the default spec with the fields set in override
+// replacing its own.
+func mergeProbe(def, override config.HealthProbe) config.HealthProbe {
+	merged := config.HealthProbe{
+		Protocol: def.Protocol,
+		HTTP:     mergeHTTP(def.HTTP, override.HTTP),
+		TCP:      mergeTCP(def.TCP, override.TCP),
+		GRPC:     mergeGRPC(def.GRPC, override.GRPC),
+	}
+
+	if override.Protocol != "" {
+		merged.Protocol = override.Protocol
+	}
+
+	return merged
+}
+
+// target is the health check state of one backend.
+type target struct {
+	probing   bool
+	successes int           // in a row
+	failures  int           // in a row
+	backoff   time.Duration // delay between checks of a down backend
+	next      time.Time     // a down backend is not checked before
+}
+
+// defaultJitter is the jitter of checks when it is not configured.
+const defaultJitter = 500 * time.Millisecond
+
 type hc struct {
-	log      *slog.Logger
-	interval time.Duration
-	timeout  time.Duration
-	balancer balancer.Balancer
+	log         *slog.Logger
+	interval    time.Duration
+	timeout     time.Duration
+	jitter      time.Duration
+	rise, fall  int
+	maxBackoff  time.Duration
+	registry    *server.Registry
+	probes      map[string]prober // by backend ID, backends missing in the config use def
+	def         prober
+	concurrency chan struct{}
+
+	ctx    context.Context // canceled by Stop
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	targets map[string]*target // by backend ID
 }
 
-func NewHealthChecker(logger *slog.Logger, interval time.Duration, timeout time.Duration, balancer balancer.Balancer) HealthChecker {
-	return &hc{
-		log:      logger,
-		interval: interval,
-		timeout:  timeout,
-		balancer: balancer}
+func NewHealthChecker(logger *slog.Logger, registry *server.Registry, cfg *config.Config) (HealthChecker, error) {
+	def, err := newProber(cfg.HealthCheck.HealthProbe)
+	if err != nil {
+		return nil, fmt.Errorf("invalid health check config: %w", err)
+	}
+
+	probes := make(map[string]prober)
+	for _, srv := range cfg.Servers {
+		id := srv.ID
+		if id == "" {
+			id = srv.URL
+		}
+
+		p, err := newProber(mergeProbe(cfg.HealthCheck.HealthProbe, srv.HealthCheck))
+		if err != nil {
+			return nil, fmt.Errorf("invalid health check config of server %q: %w", id, err)
+		}
+		probes[id] = p
+	}
+
+	hl := &hc{
+		log:         logger,
+		interval:    cfg.HealthCheck.Interval,
+		timeout:     cfg.HealthCheck.Timeout,
+		jitter:      defaultJitter,
+		rise:        max(cfg.HealthCheck.Rise, 1),
+		fall:        max(cfg.HealthCheck.Fall, 1),
+		maxBackoff:  cfg.HealthCheck.MaxBackoff,
+		registry:    registry,
+		probes:      probes,
+		def:         def,
+		concurrency: make(chan struct{}, max(cfg.HealthCheck.Concurrency, 1)),
+		targets:     make(map[string]*target),
+	}
+
+	// An explicit 0 disables the jitter.
+	if cfg.HealthCheck.Jitter != nil {
+		hl.jitter = *cfg.HealthCheck.Jitter
+	}
+	if hl.interval <= 0 {
+		hl.interval = 5 * time.Second
+	}
+	if hl.timeout <= 0 {
+		hl.timeout = 2 * time.Second
+	}
+	hl.maxBackoff = max(hl.maxBackoff, hl.interval)
+	hl.ctx, hl.cancel = context.WithCancel(context.Background())
+
+	return hl, nil
 }
 
+// HealthCheck checks every alive backend each interval and down backends at
+// doubling intervals up to maxBackoff. Checks run concurrently, so a slow
+// backend does not delay the others, and start after a random jitter.
 func (hl *hc) HealthCheck() {
-	time.Sleep(hl.interval)
+	hl.mu.Lock()
+	if hl.ctx.Err() != nil {
+		hl.mu.Unlock()
+		return
+	}
+	hl.wg.Add(1)
+	hl.mu.Unlock()
+
+	defer hl.wg.Done()
+
+	ticker := time.NewTicker(hl.interval)
+	defer ticker.Stop()
 
 	for {
-		aliveServers := hl.balancer.AliveServers()
-		downServers := hl.balancer.DownServers()
+		select {
+		case now := <-ticker.C:
+			round := hl.schedule(now)
+
+			// The next round starts on time even if checks of this one are
+			// still running, the counts are logged once they all finished.
+			hl.wg.Add(1)
+			go func() {
+				defer hl.wg.Done()
+
+				round.Wait()
+				if hl.ctx.Err() == nil {
+					hl.log.Info("HEALTHCHECK: done", slog.Int("alive", len(hl.registry.AliveServers())), slog.Int("excluded", len(hl.registry.ExcludedServers())), slog.Int("down", len(hl.registry.DownServers())))
+				}
+			}()
+		case <-hl.ctx.Done():
+			return
+		}
+	}
+}
 
-		iSub := 0
+func (hl *hc) Stop(ctx context.Context) error {
+	hl.mu.Lock()
+	hl.cancel()
+	hl.mu.Unlock()
 
-		for i := range aliveServers {
-			start := time.Now()
-			resp, err := http.Get(fmt.Sprintf("http://%s/health", aliveServers[i].URL))
-			if err != nil {
-				hl.log.Info("HEALTHCHECK: failed to get health check", slog.String("server", aliveServers[i].URL), slog.String("error", err.Error()))
+	done := make(chan struct{})
+	go func() {
+		hl.wg.Wait()
+		close(done)
+	}()
 
-				hl.balancer.AddDownServer(aliveServers[i-iSub])
-				hl.balancer.RemoveAliveServer(i - iSub)
-				iSub++
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
 
-				continue
+	// Checks still running fail, they are canceled anyway.
+	for _, p := range hl.probers() {
+		if c, ok := p.(io.Closer); ok {
+			if cerr := c.Close(); cerr != nil {
+				hl.log.Error("HEALTHCHECK: failed to close probe", slog.String("error", cerr.Error()))
 			}
-			resp.Body.Close()
+		}
+	}
 
-			if resp.StatusCode != http.StatusOK {
-				hl.log.Info("HEALTHCHECK: server is not alive", slog.String("server", aliveServers[i].URL), slog.Int("status_code", resp.StatusCode))
+	return err
+}
 
-				hl.balancer.AddDownServer(aliveServers[i-iSub])
-				hl.balancer.RemoveAliveServer(i - iSub)
-				iSub++
+// probers returns the default prober and the per-server ones.
+func (hl *hc) probers() []prober {
+	probers := []prober{hl.def}
+	for _, p := range hl.probes {
+		probers = append(probers, p)
+	}
+	return probers
+}
 
-				continue
+// schedule starts the checks of the backends that are due and not being
+// checked already. The returned WaitGroup is done when they finished.
+func (hl *hc) schedule(now time.Time) *sync.WaitGroup {
+	round := &sync.WaitGroup{}
+
+	for _, backend := range hl.registry.Backends() {
+		state := backend.State()
+		if state != server.StateAlive && state != server.StateDown {
+			// Checks of a drained backend start over once it is enabled.
+			hl.mu.Lock()
+			if t, ok := hl.targets[backend.ID]; ok && !t.probing {
+				delete(hl.targets, backend.ID)
 			}
+			hl.mu.Unlock()
+			continue
+		}
 
-			elapsed := time.Since(start)
-			if elapsed > hl.timeout {
-				hl.log.Info("HEALTHCHECK: server is not alive", slog.String("server", aliveServers[i].URL), slog.Duration("elapsed", elapsed))
+		hl.mu.Lock()
+		t, ok := hl.targets[backend.ID]
+		if !ok {
+			t = &target{}
+			hl.targets[backend.ID] = t
+		}
 
-				hl.balancer.AddDownServer(aliveServers[i-iSub])
-				hl.balancer.RemoveAliveServer(i - iSub)
-				iSub++
+		due := !t.probing && (state == server.StateAlive || !now.Before(t.next))
+		if due {
+			t.probing = true
+		}
+		hl.mu.Unlock()
 
-				continue
-			}
+		if due {
+			hl.wg.Add(1)
+			round.Add(1)
+			go func() {
+				defer round.Done()
+				hl.check(backend, t, now)
+			}()
 		}
+	}
 
-		iSub = 0
+	return round
+}
 
-		for i := range downServers {
-			start := time.Now()
-			resp, err := http.Get(fmt.Sprintf("http://%s/health", downServers[i].URL))
-			if err != nil {
-				continue
-			}
-			resp.Body.Close()
+func (hl *hc) check(backend *server.Backend, t *target, scheduled time.Time) {
+	defer hl.wg.Done()
 
-			if resp.StatusCode != http.StatusOK {
-				continue
-			}
+	if hl.jitter > 0 {
+		select {
+		case <-time.After(rand.N(hl.jitter)):
+		case <-hl.ctx.Done():
+		}
+	}
 
-			elapsed := time.Since(start)
-			if elapsed > hl.timeout {
-				continue
-			}
+	select {
+	case hl.concurrency <- struct{}{}:
+	case <-hl.ctx.Done():
+		hl.mu.Lock()
+		t.probing = false
+		hl.mu.Unlock()
+		return
+	}
+
+	elapsed, err := hl.probe(backend)
+	<-hl.concurrency
+
+	hl.mu.Lock()
+	defer hl.mu.Unlock()
+
+	t.probing = false
+	if hl.ctx.Err() != nil {
+		// Checks canceled by Stop say nothing about the backend.
+		return
+	}
+
+	state := backend.State()
+	if err != nil {
+		t.failures++
+		t.successes = 0
+	} else {
+		t.successes++
+		t.failures = 0
+	}
+
+	switch {
+	case state == server.StateAlive && err != nil:
+		if t.failures < hl.fall {
+			hl.log.Debug("HEALTHCHECK: check failed", slog.String("server", backend.URL), slog.Int("failures", t.failures), slog.String("error", err.Error()))
+			return
+		}
 
-			hl.log.Info("HEALTHCHECK: server is alive", slog.String("server", downServers[i].URL), slog.Duration("elapsed", elapsed))
+		hl.log.Info("HEALTHCHECK: server is not alive", slog.String("server", backend.URL), slog.Duration("elapsed", elapsed), slog.String("error", err.Error()))
+		hl.setState(backend, server.StateAlive, server.StateDown)
+		t.backoff = hl.interval
+		t.next = scheduled.Add(t.backoff)
+	case state == server.StateDown && err != nil:
+		t.backoff = min(max(t.backoff*2, hl.interval), hl.maxBackoff)
+		t.next = scheduled.Add(t.backoff)
+	case state == server.StateDown:
+		// Checks of a recovering backend are not delayed.
+		t.backoff = 0
+		t.next = time.Time{}
 
-			hl.balancer.AddAliveServer(downServers[i-iSub])
-			hl.balancer.RemoveDownServer(i - iSub)
-			iSub++
+		if t.successes < hl.rise {
+			hl.log.Debug("HEALTHCHECK: check passed", slog.String("server", backend.URL), slog.Int("successes", t.successes))
+			return
 		}
 
-		hl.log.Info("HEALTHCHECK: done", slog.Int("alive", len(hl.balancer.AliveServers())), slog.Int("down", len(hl.balancer.DownServers())))
+		hl.log.Info("HEALTHCHECK: server is alive", slog.String("server", backend.URL), slog.Duration("elapsed", elapsed))
+		hl.setState(backend, server.StateDown, server.StateAlive)
+	}
+}
+
+func (hl *hc) probe(backend *server.Backend) (time.Duration, error) {
+	p, ok := hl.probes[backend.ID]
+	if !ok {
+		p = hl.def
+	}
+
+	ctx, cancel := context.WithTimeout(hl.ctx, hl.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := p.probe(ctx, backend)
+
+	return time.Since(start), err
+}
 
-		time.Sleep(hl.interval)
+// setState moves the backend from the state it was checked in, so a backend
+// drained in the meantime keeps draining.
+func (hl *hc) setState(backend *server.Backend, from, state server.State) {
+	if _, err := hl.registry.CompareAndSetState(backend.ID, from, state); err != nil {
+		hl.log.Error("HEALTHCHECK: failed to update server state", slog.String("server", backend.URL), slog.String("error", err.Error()))
 	}
 }
@@ -0,0 +1,154 @@
+package healthcheck
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+// newTestChecker returns a TCP health checker of backend, without jitter and
+// rounds an hour apart. configure may change the config.
+func newTestChecker(t *testing.T, backend *server.Backend, log *slog.Logger, configure func(cfg *config.Health)) (*hc, *server.Registry) {
+	t.Helper()
+
+	registry := server.NewRegistry()
+	if err := registry.Add(backend); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		HealthCheck: config.Health{
+			Interval:    time.Hour,
+			Timeout:     time.Second,
+			Jitter:      ptr(time.Duration(0)),
+			Rise:        1,
+			Fall:        1,
+			Concurrency: 1,
+			HealthProbe: config.HealthProbe{Protocol: "tcp"},
+		},
+	}
+	if configure != nil {
+		configure(&cfg.HealthCheck)
+	}
+	if log == nil {
+		log = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+
+	checker, err := NewHealthChecker(log, registry, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { checker.Stop(context.Background()) })
+
+	return checker.(*hc), registry
+}
+
+// round runs one round of checks and waits for it.
+func (hl *hc) round() {
+	hl.schedule(time.Now()).Wait()
+}
+
+func TestHealthCheckLeavesMaintenanceAlone(t *testing.T) {
+	backend := listenTCP(t, func(net.Conn) {})
+	hl, registry := newTestChecker(t, backend, nil, nil)
+
+	if _, err := registry.SetState(backend.ID, server.StateMaintenance); err != nil {
+		t.Fatal(err)
+	}
+
+	hl.round()
+	hl.round()
+	if state := backend.State(); state != server.StateMaintenance {
+		t.Fatalf("healthy backend in maintenance is %s after checks, want maintenance", state)
+	}
+
+	// Enabled backends are checked again.
+	if _, err := registry.SetState(backend.ID, server.StateDown); err != nil {
+		t.Fatal(err)
+	}
+
+	hl.round()
+	if state := backend.State(); state != server.StateAlive {
+		t.Errorf("enabled backend is %s after a passed check, want alive", state)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	backend := listenTCP(t, func(net.Conn) {})
+
+	hl, _ := newTestChecker(t, backend, nil, func(cfg *config.Health) { cfg.Jitter = nil })
+	if hl.jitter != defaultJitter {
+		t.Errorf("unset jitter = %s, want %s", hl.jitter, defaultJitter)
+	}
+
+	hl, _ = newTestChecker(t, backend, nil, nil)
+	if hl.jitter != 0 {
+		t.Errorf("jitter = %s, want 0", hl.jitter)
+	}
+}
+
+// recordHandler sends the attributes of the records with message msg.
+type recordHandler struct {
+	slog.Handler
+	msg     string
+	records chan map[string]int64
+}
+
+func (h *recordHandler) Handle(_ context.Context, r slog.Record) error {
+	if r.Message != h.msg {
+		return nil
+	}
+
+	attrs := make(map[string]int64)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs[a.Key] = a.Value.Int64()
+		return true
+	})
+
+	select {
+	case h.records <- attrs:
+	default:
+	}
+	return nil
+}
+
+func TestHealthCheckLogsRoundAfterChecks(t *testing.T) {
+	// The backend answers after the round started.
+	backend := listenTCP(t, func(conn net.Conn) {
+		buf := make([]byte, 16)
+		conn.Read(buf)
+		time.Sleep(50 * time.Millisecond)
+		conn.Write([]byte("OK"))
+	})
+
+	h := &recordHandler{
+		Handler: slog.NewTextHandler(io.Discard, nil),
+		msg:     "HEALTHCHECK: done",
+		records: make(chan map[string]int64, 1),
+	}
+	hl, registry := newTestChecker(t, backend, slog.New(h), func(cfg *config.Health) {
+		cfg.Interval = 100 * time.Millisecond
+		cfg.TCP = config.HealthTCP{Send: "PING", Expect: "OK"}
+	})
+
+	if _, err := registry.SetState(backend.ID, server.StateDown); err != nil {
+		t.Fatal(err)
+	}
+
+	go hl.HealthCheck()
+
+	select {
+	case attrs := <-h.records:
+		if attrs["alive"] != 1 || attrs["down"] != 0 {
+			t.Errorf("first round logged alive %d, down %d, want the result of its check: alive 1, down 0", attrs["alive"], attrs["down"])
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no round was logged")
+	}
+}
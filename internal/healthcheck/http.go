@@ -0,0 +1,201 @@
+package healthcheck
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+// maxBodySize is how much of a response body or TCP reply is matched against.
+const maxBodySize = 64 << 10
+
+type statusRange struct {
+	min, max int
+}
+
+// httpProbe sends a request to the backend and checks the status code and
+// optionally the body of the response.
+type httpProbe struct {
+	client   *http.Client
+	scheme   string
+	method   string
+	path     string
+	host     string
+	headers  http.Header
+	statuses []statusRange
+	body     []byte
+	bodyRe   *regexp.Regexp
+}
+
+func newHTTPProbe(cfg config.HealthHTTP) (*httpProbe, error) {
+	p := &httpProbe{
+		client: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: enabled(cfg.InsecureSkipVerify)},
+			},
+			// Redirects are checked as they are, so 3xx can be expected.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		scheme:  "http",
+		method:  cfg.Method,
+		path:    cfg.Path,
+		host:    cfg.Host,
+		headers: make(http.Header, len(cfg.Headers)),
+		body:    []byte(cfg.Body),
+	}
+
+	if enabled(cfg.HTTPS) {
+		p.scheme = "https"
+	}
+	if p.method == "" {
+		p.method = http.MethodGet
+	}
+	if !strings.HasPrefix(p.path, "/") {
+		p.path = "/" + p.path
+	}
+
+	for name, value := range cfg.Headers {
+		p.headers.Set(name, value)
+	}
+
+	expected := cfg.ExpectedStatus
+	if len(expected) == 0 {
+		expected = []string{"200"}
+	}
+	for _, s := range expected {
+		r, err := parseStatusRange(s)
+		if err != nil {
+			return nil, err
+		}
+		p.statuses = append(p.statuses, r)
+	}
+
+	if cfg.BodyRegex != "" {
+		re, err := regexp.Compile(cfg.BodyRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid body regex: %w", err)
+		}
+		p.bodyRe = re
+	}
+
+	return p, nil
+}
+
+// parseStatusRange parses a status code like "200" or a range like "200-399".
+func parseStatusRange(s string) (statusRange, error) {
+	lo, hi, isRange := strings.Cut(strings.TrimSpace(s), "-")
+
+	from, err := strconv.Atoi(strings.TrimSpace(lo))
+	if err != nil {
+		return statusRange{}, fmt.Errorf("invalid expected status %q", s)
+	}
+
+	to := from
+	if isRange {
+		if to, err = strconv.Atoi(strings.TrimSpace(hi)); err != nil || to < from {
+			return statusRange{}, fmt.Errorf("invalid expected status %q", s)
+		}
+	}
+
+	return statusRange{min: from, max: to}, nil
+}
+
+func (p *httpProbe) probe(ctx context.Context, backend *server.Backend) error {
+	req, err := http.NewRequestWithContext(ctx, p.method, p.scheme+"://"+backend.URL+p.path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create health check request: %w", err)
+	}
+
+	req.Header = p.headers.Clone()
+	if p.host != "" {
+		req.Host = p.host
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to get health check: %w", err)
+	}
+	// The rest of the body is read, so the connection is reused.
+	defer func() {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxBodySize))
+		resp.Body.Close()
+	}()
+
+	if !p.expectedStatus(resp.StatusCode) {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	if len(p.body) == 0 && p.bodyRe == nil {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return fmt.Errorf("failed to read health check body: %w", err)
+	}
+
+	if len(p.body) > 0 && !bytes.Contains(body, p.body) {
+		return fmt.Errorf("response body does not contain %q", p.body)
+	}
+	if p.bodyRe != nil && !p.bodyRe.Match(body) {
+		return fmt.Errorf("response body does not match %q", p.bodyRe)
+	}
+
+	return nil
+}
+
+func (p *httpProbe) expectedStatus(code int) bool {
+	for _, r := range p.statuses {
+		if code >= r.min && code <= r.max {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeHTTP returns the default spec with the fields set in override replacing
+// its own.
+func mergeHTTP(def, override config.HealthHTTP) config.HealthHTTP {
+	merged := def
+
+	if override.Path != "" {
+		merged.Path = override.Path
+	}
+	if override.Method != "" {
+		merged.Method = override.Method
+	}
+	if len(override.Headers) > 0 {
+		merged.Headers = override.Headers
+	}
+	if override.Host != "" {
+		merged.Host = override.Host
+	}
+	if len(override.ExpectedStatus) > 0 {
+		merged.ExpectedStatus = override.ExpectedStatus
+	}
+	if override.Body != "" {
+		merged.Body = override.Body
+	}
+	if override.BodyRegex != "" {
+		merged.BodyRegex = override.BodyRegex
+	}
+	if override.HTTPS != nil {
+		merged.HTTPS = override.HTTPS
+	}
+	if override.InsecureSkipVerify != nil {
+		merged.InsecureSkipVerify = override.InsecureSkipVerify
+	}
+
+	return merged
+}
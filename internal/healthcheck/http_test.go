@@ -0,0 +1,193 @@
+package healthcheck
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+// listenHTTP starts handler on a local listener, over TLS if useTLS.
+func listenHTTP(t *testing.T, useTLS bool, handler http.HandlerFunc) *server.Backend {
+	t.Helper()
+
+	var ts *httptest.Server
+	if useTLS {
+		ts = httptest.NewTLSServer(handler)
+	} else {
+		ts = httptest.NewServer(handler)
+	}
+	t.Cleanup(ts.Close)
+
+	return server.NewBackend("", ts.Listener.Addr().String(), 1, 0)
+}
+
+func probeHTTP(t *testing.T, cfg config.HealthHTTP, backend *server.Backend) error {
+	t.Helper()
+
+	p, err := newHTTPProbe(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	return p.probe(ctx, backend)
+}
+
+func TestHTTPProbe(t *testing.T) {
+	health := func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+			w.Write([]byte(`{"status": "up"}`))
+		case "/starting":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/moved":
+			http.Redirect(w, r, "/health", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		tls     bool
+		cfg     config.HealthHTTP
+		wantErr string
+	}{
+		{name: "ok", cfg: config.HealthHTTP{Path: "/health"}},
+		{name: "path without slash", cfg: config.HealthHTTP{Path: "health"}},
+		{name: "unexpected status", cfg: config.HealthHTTP{Path: "/starting"}, wantErr: "unexpected status code 503"},
+		{name: "expected status", cfg: config.HealthHTTP{Path: "/starting", ExpectedStatus: []string{"200", "503"}}},
+		{name: "redirects are not followed", cfg: config.HealthHTTP{Path: "/moved"}, wantErr: "unexpected status code 302"},
+		{name: "status range", cfg: config.HealthHTTP{Path: "/moved", ExpectedStatus: []string{"200-399"}}},
+		{name: "body", cfg: config.HealthHTTP{Path: "/health", Body: `"up"`}},
+		{name: "body mismatch", cfg: config.HealthHTTP{Path: "/health", Body: "down"}, wantErr: `does not contain "down"`},
+		{name: "body regex", cfg: config.HealthHTTP{Path: "/health", BodyRegex: `"status":\s*"up"`}},
+		{name: "body regex mismatch", cfg: config.HealthHTTP{Path: "/health", BodyRegex: `^down$`}, wantErr: "does not match"},
+		{name: "https skip verify", tls: true, cfg: config.HealthHTTP{Path: "/health", HTTPS: ptr(true), InsecureSkipVerify: ptr(true)}},
+		{name: "https verification fails", tls: true, cfg: config.HealthHTTP{Path: "/health", HTTPS: ptr(true)}, wantErr: "certificate"},
+		{name: "http to an https server", tls: true, cfg: config.HealthHTTP{Path: "/health"}, wantErr: "unexpected status code 400"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := listenHTTP(t, tt.tls, health)
+			checkErr(t, probeHTTP(t, tt.cfg, backend), tt.wantErr)
+		})
+	}
+}
+
+func TestHTTPProbeRequest(t *testing.T) {
+	got := make(chan *http.Request, 1)
+	backend := listenHTTP(t, false, func(w http.ResponseWriter, r *http.Request) {
+		got <- r
+	})
+
+	cfg := config.HealthHTTP{
+		Path:    "/ready",
+		Method:  http.MethodHead,
+		Headers: map[string]string{"X-Health-Token": "secret"},
+		Host:    "health.internal",
+	}
+	if err := probeHTTP(t, cfg, backend); err != nil {
+		t.Fatal(err)
+	}
+
+	r := <-got
+	if r.Method != http.MethodHead || r.URL.Path != "/ready" || r.Host != "health.internal" || r.Header.Get("X-Health-Token") != "secret" {
+		t.Errorf("request = %s %s, host %q, token %q", r.Method, r.URL.Path, r.Host, r.Header.Get("X-Health-Token"))
+	}
+}
+
+func TestHTTPProbeReusesConnections(t *testing.T) {
+	// The end of the body comes late, so only the probe reading it lets the
+	// connection be reused, the transport itself drains only for a moment.
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 1<<10)))
+		http.NewResponseController(w).Flush()
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte(strings.Repeat("x", 1<<10)))
+	}))
+
+	var conns atomic.Int32
+	ts.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	ts.Start()
+	t.Cleanup(ts.Close)
+	backend := server.NewBackend("", ts.Listener.Addr().String(), 1, 0)
+
+	p, err := newHTTPProbe(config.HealthHTTP{Path: "/health"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 3 {
+		if err := p.probe(context.Background(), backend); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := conns.Load(); n != 1 {
+		t.Errorf("%d connections for 3 checks, want 1", n)
+	}
+}
+
+func TestMergeHTTP(t *testing.T) {
+	tests := []struct {
+		name          string
+		def, override config.HealthHTTP
+		wantPath      string
+		wantHTTPS     bool
+		wantSkip      bool
+	}{
+		{
+			name:      "unset keeps the default",
+			def:       config.HealthHTTP{Path: "/health", HTTPS: ptr(true), InsecureSkipVerify: ptr(true)},
+			wantPath:  "/health",
+			wantHTTPS: true,
+			wantSkip:  true,
+		},
+		{
+			name:      "override enables",
+			def:       config.HealthHTTP{Path: "/health"},
+			override:  config.HealthHTTP{HTTPS: ptr(true), InsecureSkipVerify: ptr(true)},
+			wantPath:  "/health",
+			wantHTTPS: true,
+			wantSkip:  true,
+		},
+		{
+			name:     "override disables",
+			def:      config.HealthHTTP{Path: "/health", HTTPS: ptr(true), InsecureSkipVerify: ptr(true)},
+			override: config.HealthHTTP{Path: "/ready", HTTPS: ptr(false), InsecureSkipVerify: ptr(false)},
+			wantPath: "/ready",
+		},
+		{
+			name:      "override restores verification only",
+			def:       config.HealthHTTP{Path: "/health", HTTPS: ptr(true), InsecureSkipVerify: ptr(true)},
+			override:  config.HealthHTTP{InsecureSkipVerify: ptr(false)},
+			wantPath:  "/health",
+			wantHTTPS: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeHTTP(tt.def, tt.override)
+			if got.Path != tt.wantPath || enabled(got.HTTPS) != tt.wantHTTPS || enabled(got.InsecureSkipVerify) != tt.wantSkip {
+				t.Errorf("merged = {%s %v %v}, want {%s %v %v}", got.Path, enabled(got.HTTPS), enabled(got.InsecureSkipVerify), tt.wantPath, tt.wantHTTPS, tt.wantSkip)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package healthcheck
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+// tcpProbe connects to the backend and optionally writes a payload and
+// matches the reply.
+type tcpProbe struct {
+	dialer net.Dialer
+	send   []byte
+	expect []byte
+}
+
+func newTCPProbe(cfg config.HealthTCP) *tcpProbe {
+	return &tcpProbe{
+		send:   []byte(cfg.Send),
+		expect: []byte(cfg.Expect),
+	}
+}
+
+func (p *tcpProbe) probe(ctx context.Context, backend *server.Backend) error {
+	conn, err := p.dialer.DialContext(ctx, "tcp", backend.URL)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if len(p.send) > 0 {
+		if _, err := conn.Write(p.send); err != nil {
+			return fmt.Errorf("failed to send payload: %w", err)
+		}
+	}
+
+	if len(p.expect) == 0 {
+		return nil
+	}
+
+	// The reply may arrive in several segments.
+	reply := make([]byte, 0, 512)
+	buf := make([]byte, 512)
+	for len(reply) < maxBodySize {
+		n, err := conn.Read(buf)
+		reply = append(reply, buf[:n]...)
+		if bytes.Contains(reply, p.expect) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reply does not contain %q: %w", p.expect, err)
+		}
+	}
+
+	return fmt.Errorf("reply does not contain %q", p.expect)
+}
+
+func mergeTCP(def, override config.HealthTCP) config.HealthTCP {
+	merged := def
+
+	if override.Send != "" {
+		merged.Send = override.Send
+	}
+	if override.Expect != "" {
+		merged.Expect = override.Expect
+	}
+
+	return merged
+}
@@ -0,0 +1,136 @@
+package healthcheck
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+// listenTCP serves every connection of a local listener with handle and
+// returns the backend of the listener.
+func listenTCP(t *testing.T, handle func(conn net.Conn)) *server.Backend {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+
+	return server.NewBackend("", ln.Addr().String(), 1, 0)
+}
+
+// closedAddr returns the address of a listener that was closed.
+func closedAddr(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	return addr
+}
+
+// redis answers PING with +PONG, split in two segments.
+func redis(conn net.Conn) {
+	buf := make([]byte, 64)
+	n, _ := conn.Read(buf)
+	if strings.HasPrefix(string(buf[:n]), "PING") {
+		conn.Write([]byte("+PO"))
+		time.Sleep(10 * time.Millisecond)
+		conn.Write([]byte("NG\r\n"))
+	}
+}
+
+func TestTCPProbe(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.HealthTCP
+		handle  func(conn net.Conn)
+		wantErr string
+	}{
+		{name: "connect only", handle: func(net.Conn) {}},
+		{name: "send and expect", cfg: config.HealthTCP{Send: "PING\r\n", Expect: "+PONG"}, handle: redis},
+		{name: "send only", cfg: config.HealthTCP{Send: "PING\r\n"}, handle: func(net.Conn) {}},
+		{name: "expect banner", cfg: config.HealthTCP{Expect: "SSH-2.0"}, handle: func(conn net.Conn) {
+			conn.Write([]byte("SSH-2.0-OpenSSH_9.6\r\n"))
+		}},
+		{name: "unexpected reply", cfg: config.HealthTCP{Send: "PING\r\n", Expect: "+PONG"}, handle: func(conn net.Conn) {
+			conn.Write([]byte("-ERR unknown command\r\n"))
+		}, wantErr: "reply does not contain"},
+		{name: "no reply", cfg: config.HealthTCP{Send: "PING\r\n", Expect: "+PONG"}, handle: func(conn net.Conn) {
+			time.Sleep(time.Second)
+		}, wantErr: "reply does not contain"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := listenTCP(t, tt.handle)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			err := newTCPProbe(tt.cfg).probe(ctx, backend)
+			checkErr(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestTCPProbeConnectionRefused(t *testing.T) {
+	backend := server.NewBackend("", closedAddr(t), 1, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err := newTCPProbe(config.HealthTCP{}).probe(ctx, backend)
+	checkErr(t, err, "failed to connect")
+}
+
+func TestMergeTCP(t *testing.T) {
+	def := config.HealthTCP{Send: "PING\r\n", Expect: "+PONG"}
+
+	got := mergeTCP(def, config.HealthTCP{Expect: "PONG"})
+	if got.Send != "PING\r\n" || got.Expect != "PONG" {
+		t.Errorf("merged = %+v", got)
+	}
+
+	if got := mergeTCP(def, config.HealthTCP{}); got != def {
+		t.Errorf("merged with empty override = %+v, want %+v", got, def)
+	}
+}
+
+// checkErr fails the test unless err contains want, or is nil when want is
+// empty.
+func checkErr(t *testing.T, err error, want string) {
+	t.Helper()
+
+	switch {
+	case want == "" && err != nil:
+		t.Errorf("unexpected error: %v", err)
+	case want != "" && err == nil:
+		t.Errorf("no error, want %q", want)
+	case want != "" && !strings.Contains(err.Error(), want):
+		t.Errorf("error = %v, want %q", err, want)
+	}
+}
@@ -0,0 +1,291 @@
+package outlier
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+	"github.com/dzhordano/balancer-go/internal/server"
+	"github.com/dzhordano/balancer-go/pkg/metrics"
+)
+
+// exclusionReason is the reason ejected backends are excluded from the
+// registry with.
+const exclusionReason = "outlier"
+
+const (
+	defaultConsecutive5xx         = 5
+	defaultConsecutiveGateway     = 5
+	defaultSuccessRateStdevFactor = 1.9
+)
+
+const (
+	reasonConsecutive5xx     = "consecutive_5xx"
+	reasonConsecutiveGateway = "consecutive_gateway_failure"
+	reasonSuccessRate        = "success_rate"
+)
+
+// host is the outcome of the requests proxied to one backend. Counters are
+// updated lock-free, ejection state is guarded by the detector.
+type host struct {
+	backend *server.Backend
+
+	consecutive5xx     atomic.Int64
+	consecutiveGateway atomic.Int64
+	requests           atomic.Int64 // in the current interval
+	successes          atomic.Int64 // in the current interval
+
+	ejected      bool
+	ejections    int // multiplier of the ejection time
+	ejectedUntil time.Time
+}
+
+// Detector ejects backends whose proxied responses are worse than the
+// others': consecutive 5xx, consecutive gateway failures or a success rate
+// statistically below the cluster mean. Ejected backends are excluded from
+// selection until their ejection time passes, which grows with every ejection.
+type Detector struct {
+	log      *slog.Logger
+	registry *server.Registry
+	cfg      config.OutlierDetection
+
+	// Thresholds, 0 disables the check.
+	consecutive5xx     int
+	consecutiveGateway int
+	stdevFactor        float64
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+
+	hosts   sync.Map // backend ID -> *host
+	mu      sync.Mutex
+	updates server.Queue // exclusions are applied in the background, ejections happen on the request path
+}
+
+// NewDetector starts the detector and returns it, or nil when outlier
+// detection is disabled. Recording to a nil Detector does nothing. Stop stops
+// it.
+func NewDetector(log *slog.Logger, registry *server.Registry, cfg config.OutlierDetection) *Detector {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = 10 * time.Second
+	}
+	if cfg.BaseEjectionTime <= 0 {
+		cfg.BaseEjectionTime = 30 * time.Second
+	}
+
+	d := &Detector{
+		log:                log,
+		registry:           registry,
+		cfg:                cfg,
+		consecutive5xx:     defaultConsecutive5xx,
+		consecutiveGateway: defaultConsecutiveGateway,
+		stdevFactor:        defaultSuccessRateStdevFactor,
+		stop:               make(chan struct{}),
+		done:               make(chan struct{}),
+	}
+
+	// Unset thresholds get their default, an explicit 0 disables them.
+	if cfg.Consecutive5xx != nil {
+		d.consecutive5xx = *cfg.Consecutive5xx
+	}
+	if cfg.ConsecutiveGatewayFailure != nil {
+		d.consecutiveGateway = *cfg.ConsecutiveGatewayFailure
+	}
+	if cfg.SuccessRateStdevFactor != nil {
+		d.stdevFactor = *cfg.SuccessRateStdevFactor
+	}
+
+	go d.run()
+
+	return d
+}
+
+// Record reports the response status of a request proxied to backend.
+// Transport errors are recorded as 502 Bad Gateway.
+func (d *Detector) Record(backend *server.Backend, status int) {
+	if d == nil {
+		return
+	}
+
+	v, ok := d.hosts.Load(backend.ID)
+	if !ok {
+		v, _ = d.hosts.LoadOrStore(backend.ID, &host{backend: backend})
+	}
+	h := v.(*host)
+
+	h.requests.Add(1)
+	if status < http.StatusInternalServerError {
+		h.successes.Add(1)
+		h.consecutive5xx.Store(0)
+		h.consecutiveGateway.Store(0)
+		return
+	}
+
+	n5xx := h.consecutive5xx.Add(1)
+
+	var nGateway int64
+	switch status {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		nGateway = h.consecutiveGateway.Add(1)
+	default:
+		h.consecutiveGateway.Store(0)
+	}
+
+	switch {
+	case d.consecutive5xx > 0 && n5xx >= int64(d.consecutive5xx):
+		d.eject(h, reasonConsecutive5xx)
+	case d.consecutiveGateway > 0 && nGateway >= int64(d.consecutiveGateway):
+		d.eject(h, reasonConsecutiveGateway)
+	}
+}
+
+// Stop stops the analysis and waits for the pending registry updates. Ejected
+// backends stay excluded.
+func (d *Detector) Stop() {
+	if d == nil {
+		return
+	}
+
+	d.stopOnce.Do(func() { close(d.stop) })
+	<-d.done
+	d.updates.Wait()
+}
+
+func (d *Detector) run() {
+	defer close(d.done)
+
+	ticker := time.NewTicker(d.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.tick()
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// tick returns backends whose ejection time passed and ejects the outliers
+// of the success rate analysis of the last interval.
+func (d *Detector) tick() {
+	now := time.Now()
+
+	var (
+		candidates []*host
+		rates      []float64
+	)
+
+	d.hosts.Range(func(_, v any) bool {
+		h := v.(*host)
+		requests, successes := h.requests.Swap(0), h.successes.Swap(0)
+
+		d.mu.Lock()
+		switch {
+		case h.ejected && now.After(h.ejectedUntil):
+			d.uneject(h)
+		case !h.ejected && h.ejections > 0 && requests == successes:
+			// A healthy interval lowers the time of the next ejection.
+			h.ejections--
+		}
+		ejected := h.ejected
+		d.mu.Unlock()
+
+		if !ejected && d.cfg.SuccessRateRequestVolume > 0 && requests >= int64(d.cfg.SuccessRateRequestVolume) {
+			candidates = append(candidates, h)
+			rates = append(rates, float64(successes)/float64(requests))
+		}
+
+		return true
+	})
+
+	if d.stdevFactor <= 0 || len(candidates) == 0 || len(candidates) < d.cfg.SuccessRateMinHosts {
+		return
+	}
+
+	var mean float64
+	for _, rate := range rates {
+		mean += rate
+	}
+	mean /= float64(len(rates))
+
+	var variance float64
+	for _, rate := range rates {
+		variance += (rate - mean) * (rate - mean)
+	}
+	stdev := math.Sqrt(variance / float64(len(rates)))
+
+	threshold := mean - d.stdevFactor*stdev
+	for i, h := range candidates {
+		if rates[i] < threshold {
+			d.eject(h, reasonSuccessRate)
+		}
+	}
+}
+
+func (d *Detector) eject(h *host, reason string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if h.ejected || !d.canEject() {
+		return
+	}
+
+	h.ejections++
+	ejection := d.cfg.BaseEjectionTime * time.Duration(h.ejections)
+	if d.cfg.MaxEjectionTime > 0 && ejection > d.cfg.MaxEjectionTime {
+		ejection = d.cfg.MaxEjectionTime
+	}
+
+	h.ejected = true
+	h.ejectedUntil = time.Now().Add(ejection)
+	h.consecutive5xx.Store(0)
+	h.consecutiveGateway.Store(0)
+
+	d.log.Info("OUTLIER: server ejected", slog.String("server", h.backend.URL), slog.String("reason", reason), slog.Duration("ejection", ejection))
+	metrics.OutlierEjected(h.backend.ID, reason)
+
+	d.updates.Add(func() {
+		if _, err := d.registry.Exclude(h.backend.ID, exclusionReason); err != nil {
+			d.log.Error("OUTLIER: failed to update server", slog.String("server", h.backend.URL), slog.String("error", err.Error()))
+		}
+	})
+}
+
+func (d *Detector) uneject(h *host) {
+	h.ejected = false
+
+	d.log.Info("OUTLIER: server returned", slog.String("server", h.backend.URL))
+	metrics.OutlierReturned(h.backend.ID)
+
+	d.updates.Add(func() {
+		if _, err := d.registry.Include(h.backend.ID, exclusionReason); err != nil {
+			d.log.Error("OUTLIER: failed to update server", slog.String("server", h.backend.URL), slog.String("error", err.Error()))
+		}
+	})
+}
+
+// canEject reports whether one more backend may be ejected without exceeding
+// the max ejection percent. One backend may always be ejected.
+func (d *Detector) canEject() bool {
+	var ejected int
+	d.hosts.Range(func(_, v any) bool {
+		if v.(*host).ejected {
+			ejected++
+		}
+		return true
+	})
+
+	total := len(d.registry.Backends())
+	return ejected == 0 || float64(ejected+1)*100 <= d.cfg.MaxEjectionPercent*float64(total)
+}
@@ -0,0 +1,132 @@
+package outlier
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func newTestDetector(t *testing.T, cfg config.OutlierDetection) (*Detector, *server.Registry) {
+	t.Helper()
+
+	registry := server.NewRegistry()
+	for _, url := range []string{"http://a", "http://b"} {
+		if err := registry.Add(server.NewBackend("", url, 1, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg.Enabled = true
+	cfg.Interval = time.Hour
+	cfg.MaxEjectionPercent = 100
+	d := NewDetector(slog.New(slog.NewTextHandler(io.Discard, nil)), registry, cfg)
+	t.Cleanup(d.Stop)
+
+	return d, registry
+}
+
+func TestDetectorThresholds(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       config.OutlierDetection
+		status    int
+		responses int
+		ejected   bool
+	}{
+		{name: "default consecutive 5xx", status: http.StatusInternalServerError, responses: 5, ejected: true},
+		{name: "below default consecutive 5xx", status: http.StatusInternalServerError, responses: 4},
+		{
+			name:      "consecutive 5xx disabled",
+			cfg:       config.OutlierDetection{Consecutive5xx: ptr(0)},
+			status:    http.StatusInternalServerError,
+			responses: 50,
+		},
+		{
+			name:      "default consecutive gateway failures",
+			cfg:       config.OutlierDetection{Consecutive5xx: ptr(0)},
+			status:    http.StatusBadGateway,
+			responses: 5,
+			ejected:   true,
+		},
+		{
+			name:      "both disabled",
+			cfg:       config.OutlierDetection{Consecutive5xx: ptr(0), ConsecutiveGatewayFailure: ptr(0)},
+			status:    http.StatusBadGateway,
+			responses: 50,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, registry := newTestDetector(t, tt.cfg)
+			backend, _ := registry.Get("http://a")
+
+			for range tt.responses {
+				d.Record(backend, tt.status)
+			}
+			d.updates.Wait()
+
+			excluded := len(registry.ExcludedServers()) == 1
+			if excluded != tt.ejected {
+				t.Errorf("ejected = %t, want %t", excluded, tt.ejected)
+			}
+		})
+	}
+}
+
+func TestDetectorStdevFactor(t *testing.T) {
+	d, _ := newTestDetector(t, config.OutlierDetection{})
+	if d.stdevFactor != defaultSuccessRateStdevFactor {
+		t.Errorf("unset success_rate_stdev_factor = %v, want %v", d.stdevFactor, defaultSuccessRateStdevFactor)
+	}
+
+	d, _ = newTestDetector(t, config.OutlierDetection{SuccessRateStdevFactor: ptr(0.0)})
+	if d.stdevFactor != 0 {
+		t.Errorf("success_rate_stdev_factor = %v, want 0", d.stdevFactor)
+	}
+}
+
+func TestEjectedServersAreNotAlive(t *testing.T) {
+	d, registry := newTestDetector(t, config.OutlierDetection{Consecutive5xx: ptr(1)})
+	backend, _ := registry.Get("http://a")
+
+	d.Record(backend, http.StatusInternalServerError)
+	d.Stop()
+
+	alive := registry.AliveServers()
+	if len(alive) != 1 || alive[0].ID != "http://b" {
+		t.Errorf("alive servers = %v, want only http://b", alive)
+	}
+	if excluded := registry.ExcludedServers(); len(excluded) != 1 || excluded[0] != backend {
+		t.Errorf("excluded servers = %v, want %s", excluded, backend.ID)
+	}
+}
+
+func TestDetectorStop(t *testing.T) {
+	d, _ := newTestDetector(t, config.OutlierDetection{})
+
+	stopped := make(chan struct{})
+	go func() {
+		d.Stop()
+		d.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop did not return")
+	}
+
+	var nilDetector *Detector
+	nilDetector.Stop()
+}
@@ -0,0 +1,63 @@
+package server
+
+import "sync"
+
+// Queue runs functions one at a time in the background, in the order they
+// were added. Exclusions from the request path go through it, so requests
+// don't wait for balancers to rebuild their tables. The zero value is ready
+// to use.
+type Queue struct {
+	mu      sync.Mutex
+	pending []func()
+	running bool
+	idle    *sync.Cond // signaled when the queue runs empty
+}
+
+// Add queues fn without blocking.
+func (q *Queue) Add(fn func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.pending = append(q.pending, fn)
+	if !q.running {
+		q.running = true
+		go q.run()
+	}
+}
+
+// Wait blocks until every queued function ran.
+func (q *Queue) Wait() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for q.running {
+		q.cond().Wait()
+	}
+}
+
+func (q *Queue) run() {
+	for {
+		q.mu.Lock()
+		if len(q.pending) == 0 {
+			q.running = false
+			q.cond().Broadcast()
+			q.mu.Unlock()
+			return
+		}
+
+		fn := q.pending[0]
+		q.pending[0] = nil
+		q.pending = q.pending[1:]
+		q.mu.Unlock()
+
+		fn()
+	}
+}
+
+// cond must be called with mu held.
+func (q *Queue) cond() *sync.Cond {
+	if q.idle == nil {
+		q.idle = sync.NewCond(&q.mu)
+	}
+	return q.idle
+}
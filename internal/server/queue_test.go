@@ -0,0 +1,55 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueueRunsInOrder(t *testing.T) {
+	var q Queue
+
+	var got []int
+	for i := range 100 {
+		q.Add(func() { got = append(got, i) })
+	}
+	q.Wait()
+
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("function %d ran at position %d", v, i)
+		}
+	}
+	if len(got) != 100 {
+		t.Fatalf("%d functions ran, want 100", len(got))
+	}
+}
+
+func TestQueueAddDoesNotBlock(t *testing.T) {
+	var q Queue
+
+	release := make(chan struct{})
+	q.Add(func() { <-release })
+
+	added := make(chan struct{})
+	go func() {
+		q.Add(func() {})
+		close(added)
+	}()
+
+	select {
+	case <-added:
+	case <-time.After(time.Second):
+		t.Fatal("Add blocked on a running function")
+	}
+
+	close(release)
+	q.Wait()
+
+	// The queue starts again after it ran empty.
+	ran := false
+	q.Add(func() { ran = true })
+	q.Wait()
+	if !ran {
+		t.Error("function added to an idle queue did not run")
+	}
+}
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Registry holds the backends keyed by their ID and tracks their state.
+// Listeners are notified with the selectable backends, alive and not
+// excluded, on every membership change.
+type Registry struct {
+	mu        sync.Mutex
+	backends  map[string]*Backend
+	order     []*Backend // in the order they were added
+	listeners []func(selectable []*Backend)
+	watchers  []func(c Change)
+}
+
+// Change is a state change of a backend or, when Reason is set, its exclusion
+// from or inclusion back into selection.
+type Change struct {
+	Backend  *Backend
+	From, To State
+	Reason   string
+	Excluded bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{backends: make(map[string]*Backend)}
+}
+
+// Add registers an alive backend.
+func (r *Registry) Add(b *Backend) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.backends[b.ID]; ok {
+		return fmt.Errorf("backend %q is already registered", b.ID)
+	}
+
+	b.state.Store(int32(StateAlive))
+	b.aliveSince.Store(time.Now().UnixNano())
+	r.backends[b.ID] = b
+	r.order = append(r.order, b)
+	r.notify()
+
+	return nil
+}
+
+func (r *Registry) Get(id string) (*Backend, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.backends[id]
+	return b, ok
+}
+
+// Backends returns every registered backend regardless of its state.
+func (r *Registry) Backends() []*Backend {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*Backend(nil), r.order...)
+}
+
+// AliveServers returns the backends requests are sent to: alive and not
+// excluded.
+func (r *Registry) AliveServers() []*Backend {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.selectableLocked()
+}
+
+// ExcludedServers returns the alive backends taken out of selection by an
+// exclusion, like an open circuit breaker or an outlier ejection.
+func (r *Registry) ExcludedServers() []*Backend {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var backends []*Backend
+	for _, b := range r.order {
+		if b.State() == StateAlive && len(b.excluded) > 0 {
+			backends = append(backends, b)
+		}
+	}
+
+	return backends
+}
+
+func (r *Registry) DownServers() []*Backend {
+	return r.inState(StateDown)
+}
+
+// SetState moves the backend to state and reports whether it changed.
+func (r *Registry) SetState(id string, state State) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.backends[id]
+	if !ok {
+		return false, fmt.Errorf("backend %q is not registered", id)
+	}
+
+	from := State(b.state.Swap(int32(state)))
+	if from == state {
+		return false, nil
+	}
+
+	if state == StateAlive {
+		b.aliveSince.Store(time.Now().UnixNano())
+	}
+	r.notify()
+	r.publish(Change{Backend: b, From: from, To: state})
+
+	return true, nil
+}
+
+// CompareAndSetState moves the backend to state only if it is in from and
+// reports whether it did.
+func (r *Registry) CompareAndSetState(id string, from, state State) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.backends[id]
+	if !ok {
+		return false, fmt.Errorf("backend %q is not registered", id)
+	}
+
+	if from == state || !b.state.CompareAndSwap(int32(from), int32(state)) {
+		return false, nil
+	}
+
+	if state == StateAlive {
+		b.aliveSince.Store(time.Now().UnixNano())
+	}
+	r.notify()
+	r.publish(Change{Backend: b, From: from, To: state})
+
+	return true, nil
+}
+
+// Remove takes the backend out of the registry.
+func (r *Registry) Remove(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.backends[id]
+	if !ok {
+		return fmt.Errorf("backend %q is not registered", id)
+	}
+
+	r.removeLocked(b, State(b.state.Swap(int32(StateRemoved))))
+
+	return nil
+}
+
+// CompareAndRemove takes the backend out of the registry only if it is in
+// from and reports whether it did.
+func (r *Registry) CompareAndRemove(id string, from State) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.backends[id]
+	if !ok {
+		return false, fmt.Errorf("backend %q is not registered", id)
+	}
+
+	if !b.state.CompareAndSwap(int32(from), int32(StateRemoved)) {
+		return false, nil
+	}
+	r.removeLocked(b, from)
+
+	return true, nil
+}
+
+func (r *Registry) removeLocked(b *Backend, from State) {
+	delete(r.backends, b.ID)
+	r.order = slices.DeleteFunc(r.order, func(o *Backend) bool { return o == b })
+
+	r.notify()
+	r.publish(Change{Backend: b, From: from, To: StateRemoved})
+}
+
+// Exclude keeps the backend out of selection for reason until Include is
+// called with the same reason. Its state does not change.
+func (r *Registry) Exclude(id, reason string) (bool, error) {
+	return r.setExcluded(id, reason, true)
+}
+
+func (r *Registry) Include(id, reason string) (bool, error) {
+	return r.setExcluded(id, reason, false)
+}
+
+func (r *Registry) setExcluded(id, reason string, excluded bool) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.backends[id]
+	if !ok {
+		return false, fmt.Errorf("backend %q is not registered", id)
+	}
+
+	if b.excluded[reason] == excluded {
+		return false, nil
+	}
+
+	if excluded {
+		if b.excluded == nil {
+			b.excluded = make(map[string]bool)
+		}
+		b.excluded[reason] = true
+	} else {
+		delete(b.excluded, reason)
+	}
+
+	if b.State() == StateAlive {
+		r.notify()
+	}
+	r.publish(Change{Backend: b, From: b.State(), To: b.State(), Reason: reason, Excluded: excluded})
+
+	return true, nil
+}
+
+// Subscribe calls fn with the current selectable backends and again after
+// every membership change. Calls are serialized, fn must not modify the
+// registry.
+func (r *Registry) Subscribe(fn func(selectable []*Backend)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.listeners = append(r.listeners, fn)
+	fn(r.selectableLocked())
+}
+
+// Watch calls fn after every state change and exclusion. Calls are
+// serialized, fn must not block or modify the registry.
+func (r *Registry) Watch(fn func(c Change)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.watchers = append(r.watchers, fn)
+}
+
+func (r *Registry) inState(state State) []*Backend {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var backends []*Backend
+	for _, b := range r.order {
+		if b.State() == state {
+			backends = append(backends, b)
+		}
+	}
+
+	return backends
+}
+
+// selectableLocked returns a new slice every time, listeners may keep it.
+func (r *Registry) selectableLocked() []*Backend {
+	selectable := make([]*Backend, 0, len(r.order))
+	for _, b := range r.order {
+		if b.State() == StateAlive && len(b.excluded) == 0 {
+			selectable = append(selectable, b)
+		}
+	}
+
+	return selectable
+}
+
+func (r *Registry) notify() {
+	selectable := r.selectableLocked()
+	for _, fn := range r.listeners {
+		fn(selectable)
+	}
+}
+
+func (r *Registry) publish(c Change) {
+	for _, fn := range r.watchers {
+		fn(c)
+	}
+}
@@ -0,0 +1,212 @@
+package server_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dzhordano/balancer-go/internal/balancer"
+	"github.com/dzhordano/balancer-go/internal/config"
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+// TestRegistryConcurrentUpdates flips states and exclusions while balancers
+// subscribed to the registry select backends and count connections. Run with
+// -race.
+func TestRegistryConcurrentUpdates(t *testing.T) {
+	const (
+		backends = 8
+		flips    = 200
+		selects  = 2000
+	)
+
+	registry := server.NewRegistry()
+	for i := range backends {
+		b := server.NewBackend("", fmt.Sprintf("http://backend-%d", i), i%3+1, 10)
+		if err := registry.Add(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	algorithms := []string{"round_robin", "weighted_round_robin", "least_connections", "p2c", "hash", "maglev", "random"}
+	balancers := make([]balancer.Balancer, len(algorithms))
+	for i, name := range algorithms {
+		b, err := balancer.New(name, config.BalancingOptions{Maglev: config.Maglev{TableSize: 251}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		registry.Subscribe(b.SetServers)
+		balancers[i] = b
+	}
+
+	// Every reported change must be published exactly once.
+	var reported, published atomic.Int64
+	registry.Watch(func(server.Change) { published.Add(1) })
+
+	count := func(changed bool, err error) {
+		if err != nil {
+			t.Error(err)
+		}
+		if changed {
+			reported.Add(1)
+		}
+	}
+
+	var writers, readers sync.WaitGroup
+	stop := make(chan struct{})
+
+	// One writer per backend, so its final state is known: even backends
+	// end alive and included, odd ones down and excluded.
+	for i, b := range registry.Backends() {
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+
+			for j := range flips {
+				if j%2 == 0 {
+					count(registry.SetState(b.ID, server.StateDown))
+					count(registry.Exclude(b.ID, "outlier"))
+				} else {
+					count(registry.CompareAndSetState(b.ID, server.StateDown, server.StateAlive))
+					count(registry.Include(b.ID, "outlier"))
+				}
+			}
+
+			if i%2 == 0 {
+				count(registry.SetState(b.ID, server.StateAlive))
+				count(registry.Include(b.ID, "outlier"))
+			} else {
+				count(registry.SetState(b.ID, server.StateDown))
+				count(registry.Exclude(b.ID, "outlier"))
+			}
+		}()
+	}
+
+	for _, b := range balancers {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+
+			for j := 0; ; j++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				ctx := &balancer.SelectContext{HashKey: fmt.Sprint(j), ClientIP: "127.0.0.1"}
+				if srv := b.SelectServer(ctx); srv != nil {
+					srv.IncrementConnections()
+					srv.DecrementConnections()
+				}
+			}
+		}()
+	}
+
+	writers.Wait()
+	close(stop)
+	readers.Wait()
+
+	if reported.Load() != published.Load() {
+		t.Errorf("%d changes reported, %d published", reported.Load(), published.Load())
+	}
+
+	for i, b := range registry.Backends() {
+		if got := b.CurrentConnections(); got != 0 {
+			t.Errorf("%s has %d connections, want 0", b.ID, got)
+		}
+
+		want := server.StateAlive
+		if i%2 == 1 {
+			want = server.StateDown
+		}
+		if b.State() != want {
+			t.Errorf("%s is %s, want %s", b.ID, b.State(), want)
+		}
+	}
+
+	// The last snapshot of every balancer holds only the even backends.
+	for i, b := range balancers {
+		for j := range selects {
+			ctx := &balancer.SelectContext{HashKey: fmt.Sprint(j), ClientIP: fmt.Sprintf("10.0.0.%d", j%256)}
+			srv := b.SelectServer(ctx)
+			if srv == nil {
+				t.Fatalf("%s selected nothing", algorithms[i])
+			}
+
+			var n int
+			if _, err := fmt.Sscanf(srv.URL, "http://backend-%d", &n); err != nil || n%2 == 1 {
+				t.Fatalf("%s selected %s, which is down", algorithms[i], srv.URL)
+			}
+		}
+	}
+}
+
+// TestRegistryConcurrentConnections checks connection counters lose no
+// updates.
+func TestRegistryConcurrentConnections(t *testing.T) {
+	const (
+		goroutines = 16
+		requests   = 10000
+	)
+
+	b := server.NewBackend("", "http://backend", 1, 0)
+
+	var wg sync.WaitGroup
+	for range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for range requests {
+				b.IncrementConnections()
+			}
+			for range requests / 2 {
+				b.DecrementConnections()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got, want := b.CurrentConnections(), int64(goroutines*requests/2); got != want {
+		t.Errorf("connections = %d, want %d", got, want)
+	}
+}
+
+func TestRegistryCompareAndRemove(t *testing.T) {
+	registry := server.NewRegistry()
+	b := server.NewBackend("a", "http://a", 1, 0)
+	if err := registry.Add(b); err != nil {
+		t.Fatal(err)
+	}
+
+	var changes []server.Change
+	registry.Watch(func(c server.Change) { changes = append(changes, c) })
+
+	// An enabled backend is kept.
+	if removed, err := registry.CompareAndRemove("a", server.StateDraining); err != nil || removed {
+		t.Fatalf("CompareAndRemove = %t, %v, want false, nil", removed, err)
+	}
+	if _, ok := registry.Get("a"); !ok || b.State() != server.StateAlive {
+		t.Fatalf("backend is %s and registered = %t, want alive and registered", b.State(), ok)
+	}
+
+	if _, err := registry.SetState("a", server.StateDraining); err != nil {
+		t.Fatal(err)
+	}
+	if removed, err := registry.CompareAndRemove("a", server.StateDraining); err != nil || !removed {
+		t.Fatalf("CompareAndRemove = %t, %v, want true, nil", removed, err)
+	}
+	if _, ok := registry.Get("a"); ok || b.State() != server.StateRemoved {
+		t.Errorf("backend is %s and registered = %t, want removed", b.State(), ok)
+	}
+
+	if last := changes[len(changes)-1]; last.From != server.StateDraining || last.To != server.StateRemoved {
+		t.Errorf("last change %s -> %s, want draining -> removed", last.From, last.To)
+	}
+
+	if _, err := registry.CompareAndRemove("a", server.StateDraining); err == nil {
+		t.Error("removing an unregistered backend did not fail")
+	}
+}
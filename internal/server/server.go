@@ -1,28 +1,80 @@
 package server
 
-import "sync/atomic"
+import (
+	"sync/atomic"
+	"time"
+)
 
-type Server struct {
+type State int32
+
+const (
+	StateAlive State = iota
+	StateDown
+	StateDraining    // finishing in-flight requests, no new ones are selected
+	StateRemoved     // no longer in the registry
+	StateMaintenance // drained, health checks leave it alone until it is enabled
+)
+
+func (s State) String() string {
+	switch s {
+	case StateAlive:
+		return "alive"
+	case StateDown:
+		return "down"
+	case StateDraining:
+		return "draining"
+	case StateRemoved:
+		return "removed"
+	case StateMaintenance:
+		return "maintenance"
+	default:
+		return "unknown"
+	}
+}
+
+// Backend is an upstream server. Backends are shared by pointer, so the
+// connection counter and state are seen by every user.
+type Backend struct {
+	ID                string // stable identity, the URL unless set in the config
 	URL               string
 	ActiveConnections int64
 	Weight            int
+	VirtualNodes      int // points on the consistent hash ring per unit of weight
+	state             atomic.Int32
+	aliveSince        atomic.Int64    // unix nanoseconds
+	excluded          map[string]bool // reasons the backend is kept out of selection, guarded by the registry
 }
 
-func (s *Server) IncrementConnections() {
-	atomic.AddInt64(&s.ActiveConnections, 1)
+func (b *Backend) IncrementConnections() {
+	atomic.AddInt64(&b.ActiveConnections, 1)
 }
 
-func (s *Server) DecrementConnections() {
-	atomic.AddInt64(&s.ActiveConnections, -1)
+func (b *Backend) DecrementConnections() {
+	atomic.AddInt64(&b.ActiveConnections, -1)
 }
 
-func (s *Server) CurrentConnections() int64 {
-	return atomic.LoadInt64(&s.ActiveConnections)
+func (b *Backend) CurrentConnections() int64 {
+	return atomic.LoadInt64(&b.ActiveConnections)
 }
 
-func NewServer(url string, weight int) *Server {
-	return &Server{
-		URL:    url,
-		Weight: weight,
+func (b *Backend) State() State {
+	return State(b.state.Load())
+}
+
+// AliveSince returns when the backend was added or last came back alive.
+func (b *Backend) AliveSince() time.Time {
+	return time.Unix(0, b.aliveSince.Load())
+}
+
+func NewBackend(id, url string, weight int, virtualNodes int) *Backend {
+	if id == "" {
+		id = url
+	}
+
+	return &Backend{
+		ID:           id,
+		URL:          url,
+		Weight:       weight,
+		VirtualNodes: virtualNodes,
 	}
 }
@@ -0,0 +1,254 @@
+package upstream
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+	"github.com/dzhordano/balancer-go/internal/server"
+	"github.com/dzhordano/balancer-go/pkg/metrics"
+)
+
+// Pool holds a dedicated http.Transport per backend, so connection limits and
+// keep-alive apply to each server separately.
+type Pool struct {
+	cfg        config.Upstream
+	mu         sync.Mutex
+	transports map[string]*transport // by backend ID
+}
+
+func NewPool(cfg config.Upstream) *Pool {
+	return &Pool{
+		cfg:        cfg,
+		transports: make(map[string]*transport),
+	}
+}
+
+// Watch drops the transports of backends removed from the registry.
+func (p *Pool) Watch(registry *server.Registry) {
+	registry.Watch(func(c server.Change) {
+		if c.To == server.StateRemoved {
+			p.remove(c.Backend.ID)
+		}
+	})
+}
+
+// Get returns the round tripper of backend, creating it on first use.
+func (p *Pool) Get(backend *server.Backend) http.RoundTripper {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	t, ok := p.transports[backend.ID]
+	if !ok {
+		t = newTransport(backend.ID, p.cfg)
+
+		// Retries of requests to a backend being removed are not kept.
+		if backend.State() != server.StateRemoved {
+			p.transports[backend.ID] = t
+		}
+	}
+
+	return t
+}
+
+// remove closes the idle connections of the backend and forgets its
+// transport. Connections of requests still in flight are closed once idle.
+func (p *Pool) remove(id string) {
+	p.mu.Lock()
+	t, ok := p.transports[id]
+	delete(p.transports, id)
+	p.mu.Unlock()
+
+	if ok {
+		t.removed.Store(true)
+		t.CloseIdleConnections()
+		metrics.DeleteUpstreamConnections(id)
+	}
+}
+
+// Scheme returns the scheme of the requests sent to backends.
+func (p *Pool) Scheme() string {
+	if p.cfg.TLS {
+		return "https"
+	}
+	return "http"
+}
+
+// CloseIdleConnections closes the idle connections of every backend.
+func (p *Pool) CloseIdleConnections() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, t := range p.transports {
+		t.CloseIdleConnections()
+	}
+}
+
+// transport counts the connections of one backend: open ones through the
+// dialer and in-use ones while some request got them and its body is not
+// closed. HTTP/2 requests share a connection, it counts once.
+type transport struct {
+	*http.Transport
+	id      string
+	open    atomic.Int64
+	inUse   atomic.Int64
+	removed atomic.Bool // the backend was removed, its gauges are gone
+
+	mu      sync.Mutex
+	streams map[net.Conn]int // requests on each in-use connection
+}
+
+func newTransport(id string, cfg config.Upstream) *transport {
+	t := &transport{id: id, streams: make(map[net.Conn]int)}
+
+	dialer := &net.Dialer{Timeout: cfg.DialTimeout, KeepAlive: cfg.KeepAlive}
+
+	t.Transport = &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+
+			t.open.Add(1)
+			t.report()
+
+			return &countedConn{Conn: conn, onClose: func() {
+				t.open.Add(-1)
+				t.report()
+			}}, nil
+		},
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConns,
+		MaxConnsPerHost:       cfg.MaxConns,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		TLSClientConfig:       &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify},
+		TLSHandshakeTimeout:   cfg.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+		ForceAttemptHTTP2:     cfg.HTTP2,
+	}
+
+	if !cfg.HTTP2 {
+		// A non-nil empty map disables HTTP/2 negotiation.
+		t.Transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+
+	return t
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	use := &connUse{transport: t}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{GotConn: use.got}))
+
+	resp, err := t.Transport.RoundTrip(req)
+	if err != nil {
+		use.release()
+		return nil, err
+	}
+
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: use.release}
+
+	return resp, nil
+}
+
+func (t *transport) acquire(conn net.Conn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.streams[conn]++
+	if t.streams[conn] == 1 {
+		t.inUse.Add(1)
+		t.report()
+	}
+}
+
+func (t *transport) release(conn net.Conn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.streams[conn]--
+	if t.streams[conn] == 0 {
+		delete(t.streams, conn)
+		t.inUse.Add(-1)
+		t.report()
+	}
+}
+
+// connUse is the connection one request got, until its body is closed.
+type connUse struct {
+	transport *transport
+	mu        sync.Mutex
+	conn      net.Conn
+}
+
+// got is called for every connection the request is written to, it moves to
+// another one when a reused connection turned out to be closed.
+func (u *connUse) got(info httptrace.GotConnInfo) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.conn != nil {
+		u.transport.release(u.conn)
+	}
+	u.conn = info.Conn
+	u.transport.acquire(u.conn)
+}
+
+func (u *connUse) release() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.conn != nil {
+		u.transport.release(u.conn)
+		u.conn = nil
+	}
+}
+
+func (t *transport) report() {
+	if t.removed.Load() {
+		return
+	}
+
+	inUse := t.inUse.Load()
+	metrics.SetUpstreamConnections(t.id, max(0, t.open.Load()-inUse), inUse)
+}
+
+type countedConn struct {
+	net.Conn
+	once    sync.Once
+	onClose func()
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(c.onClose)
+	return c.Conn.Close()
+}
+
+// releaseBody gives the connection back once the response is consumed.
+type releaseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.once.Do(b.release)
+	}
+	return n, err
+}
+
+func (b *releaseBody) Close() error {
+	b.once.Do(b.release)
+	return b.ReadCloser.Close()
+}
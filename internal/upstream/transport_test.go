@@ -0,0 +1,204 @@
+package upstream
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dzhordano/balancer-go/internal/config"
+	"github.com/dzhordano/balancer-go/internal/server"
+)
+
+// listen starts a backend answering with the protocol of the request, over
+// TLS with HTTP/2 enabled if useTLS.
+func listen(t *testing.T, useTLS bool) *server.Backend {
+	t.Helper()
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	}))
+	if useTLS {
+		ts.EnableHTTP2 = true
+		ts.StartTLS()
+	} else {
+		ts.Start()
+	}
+	t.Cleanup(ts.Close)
+
+	return server.NewBackend("", ts.Listener.Addr().String(), 1, 0)
+}
+
+func send(t *testing.T, p *Pool, backend *server.Backend) string {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, p.Scheme()+"://"+backend.URL+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := p.Get(backend).RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	proto, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(proto)
+}
+
+func TestPoolProtocols(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Upstream
+		want string
+	}{
+		{name: "http", want: "HTTP/1.1"},
+		{name: "tls", cfg: config.Upstream{TLS: true, InsecureSkipVerify: true}, want: "HTTP/1.1"},
+		{name: "http2", cfg: config.Upstream{TLS: true, InsecureSkipVerify: true, HTTP2: true}, want: "HTTP/2.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.TLSHandshakeTimeout = time.Second
+			backend := listen(t, tt.cfg.TLS)
+
+			if got := send(t, NewPool(tt.cfg), backend); got != tt.want {
+				t.Errorf("backend got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPoolVerifiesCertificates(t *testing.T) {
+	backend := listen(t, true)
+	p := NewPool(config.Upstream{TLS: true})
+
+	req, err := http.NewRequest(http.MethodGet, p.Scheme()+"://"+backend.URL+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = p.Get(backend).RoundTrip(req)
+	if err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("error = %v, want a certificate error", err)
+	}
+}
+
+func TestPoolCloseIdleConnections(t *testing.T) {
+	backend := listen(t, false)
+	p := NewPool(config.Upstream{MaxIdleConns: 10})
+
+	send(t, p, backend)
+
+	tr := p.transports[backend.ID]
+	if open := tr.open.Load(); open != 1 {
+		t.Fatalf("%d open connections, want 1", open)
+	}
+	if inUse := tr.inUse.Load(); inUse != 0 {
+		t.Fatalf("%d connections in use after the body was closed, want 0", inUse)
+	}
+
+	p.CloseIdleConnections()
+
+	if open := tr.open.Load(); open != 0 {
+		t.Errorf("%d open connections after CloseIdleConnections, want 0", open)
+	}
+}
+
+func TestPoolCountsConnectionsInUse(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       config.Upstream
+		wantConns int64
+	}{
+		{name: "http", wantConns: 3},
+		{name: "http2 streams share a connection", cfg: config.Upstream{TLS: true, InsecureSkipVerify: true, HTTP2: true}, wantConns: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			done := make(chan struct{})
+			ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				w.(http.Flusher).Flush()
+				<-done
+			}))
+			if tt.cfg.TLS {
+				ts.EnableHTTP2 = true
+				ts.StartTLS()
+			} else {
+				ts.Start()
+			}
+			t.Cleanup(ts.Close)
+			t.Cleanup(func() { close(done) })
+
+			tt.cfg.MaxIdleConns = 10
+			p := NewPool(tt.cfg)
+			backend := server.NewBackend("", ts.Listener.Addr().String(), 1, 0)
+
+			// Every response is open until its body is closed.
+			var bodies []io.Closer
+			for range 3 {
+				req, err := http.NewRequest(http.MethodGet, p.Scheme()+"://"+backend.URL+"/", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp, err := p.Get(backend).RoundTrip(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				bodies = append(bodies, resp.Body)
+			}
+
+			tr := p.transports[backend.ID]
+			if open, inUse := tr.open.Load(), tr.inUse.Load(); open != tt.wantConns || inUse != tt.wantConns {
+				t.Errorf("%d open and %d in use connections, want %d of both", open, inUse, tt.wantConns)
+			}
+
+			for _, body := range bodies {
+				body.Close()
+			}
+			if inUse := tr.inUse.Load(); inUse != 0 {
+				t.Errorf("%d connections in use after the bodies were closed, want 0", inUse)
+			}
+		})
+	}
+}
+
+func TestPoolDropsRemovedBackends(t *testing.T) {
+	backend := listen(t, false)
+	registry := server.NewRegistry()
+	if err := registry.Add(backend); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewPool(config.Upstream{MaxIdleConns: 10})
+	p.Watch(registry)
+
+	send(t, p, backend)
+	tr := p.transports[backend.ID]
+
+	if err := registry.Remove(backend.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := p.transports[backend.ID]; ok {
+		t.Error("transport of the removed backend is kept")
+	}
+	if open := tr.open.Load(); open != 0 {
+		t.Errorf("%d open connections to the removed backend, want 0", open)
+	}
+
+	// Requests still retried to it don't bring the transport back.
+	send(t, p, backend)
+	if _, ok := p.transports[backend.ID]; ok {
+		t.Error("transport of the removed backend was recreated")
+	}
+}
@@ -21,11 +21,67 @@ var (
 		},
 		[]string{"server"},
 	)
+	upstreamConnections = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "upstream_connections",
+			Help: "Number of connections to the servers by state (idle, in_use)",
+		},
+		[]string{"server", "state"},
+	)
+	hedgesSent = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "hedged_requests_sent_total",
+			Help: "Total number of hedged requests sent",
+		},
+		[]string{"route"},
+	)
+	hedgesWon = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "hedged_requests_won_total",
+			Help: "Total number of hedged requests that answered before the original one",
+		},
+		[]string{"route"},
+	)
+	breakerState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "circuit_breaker_state",
+			Help: "State of the server's circuit breaker (0 closed, 1 open, 2 half-open)",
+		},
+		[]string{"server"},
+	)
+	breakerTransitions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "circuit_breaker_transitions_total",
+			Help: "Total number of circuit breaker state changes",
+		},
+		[]string{"server", "from", "to"},
+	)
+	outlierEjections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "outlier_ejections_total",
+			Help: "Total number of servers ejected by outlier detection",
+		},
+		[]string{"server", "reason"},
+	)
+	outlierEjected = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "outlier_ejected",
+			Help: "Whether the server is ejected by outlier detection",
+		},
+		[]string{"server"},
+	)
 )
 
 func init() {
 	prometheus.MustRegister(requestsTotal)
 	prometheus.MustRegister(concreteURLRequests)
+	prometheus.MustRegister(upstreamConnections)
+	prometheus.MustRegister(hedgesSent)
+	prometheus.MustRegister(hedgesWon)
+	prometheus.MustRegister(breakerState)
+	prometheus.MustRegister(breakerTransitions)
+	prometheus.MustRegister(outlierEjections)
+	prometheus.MustRegister(outlierEjected)
 }
 
 func InstrumentHandler(endpoint string, next http.HandlerFunc) http.HandlerFunc {
@@ -41,3 +97,34 @@ func InstrumentConcretePathRequests(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+func SetUpstreamConnections(server string, idle, inUse int64) {
+	upstreamConnections.WithLabelValues(server, "idle").Set(float64(idle))
+	upstreamConnections.WithLabelValues(server, "in_use").Set(float64(inUse))
+}
+
+func DeleteUpstreamConnections(server string) {
+	upstreamConnections.DeletePartialMatch(prometheus.Labels{"server": server})
+}
+
+func HedgeSent(route string) {
+	hedgesSent.WithLabelValues(route).Inc()
+}
+
+func HedgeWon(route string) {
+	hedgesWon.WithLabelValues(route).Inc()
+}
+
+func BreakerTransition(server, from, to string, state int) {
+	breakerTransitions.WithLabelValues(server, from, to).Inc()
+	breakerState.WithLabelValues(server).Set(float64(state))
+}
+
+func OutlierEjected(server, reason string) {
+	outlierEjections.WithLabelValues(server, reason).Inc()
+	outlierEjected.WithLabelValues(server).Set(1)
+}
+
+func OutlierReturned(server string) {
+	outlierEjected.WithLabelValues(server).Set(0)
+}